@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/g3n/engine/app"
@@ -18,16 +19,33 @@ import (
 	"github.com/g3n/engine/util"
 	"github.com/g3n/engine/util/helper"
 	"github.com/g3n/engine/window"
+	"go.bug.st/serial"
 )
 
 const (
 	targetFPS   = 120
-	historySize = 10 * 200
-	posScale    = 100 // m to cm
+	historySize = 5 * 60 * 200 // samples, 5 minutes at 200 Hz
+	graphPoints = 1000         // points per chart line, resampled over the window
+	posScale    = 100          // m to cm
+
+	historySeconds  = 5 * 60 // longest trail and chart window
+	defaultWindow   = 10     // seconds
+	chartScaleLines = 5
+)
+
+// Transports selectable in the sidebar
+const (
+	transportSerial    = "Serial"
+	transportTCPClient = "TCP Client"
+	transportTCPServer = "TCP Server"
+	transportUDP       = "UDP"
+
+	defaultTCPAddr = "192.168.4.1:3333"
+
+	portScanInterval = 1 * time.Second
 )
 
 //todo: move all of the stack-initialsied members to class properties for global access
-//todo: colour history particles based on the velocity of the device
 
 type App struct {
 	*app.Application
@@ -42,15 +60,53 @@ type App struct {
 
 	sidebar *gui.Panel
 
+	transport_p  *gui.Panel
+	transport_l  *gui.Label
+	transport_dd *gui.DropDown
+	transport_ed *gui.Edit
+	format_dd    *gui.DropDown
+
 	serial_p   *gui.Panel
 	serial_l   *gui.Label
 	serial_dd  *gui.DropDown
 	serial_btn *gui.Button
-
-	trail_p  *gui.Panel
-	trail_l  *gui.Label
-	trail_sl *gui.Slider
-	histShow int
+	discon_btn *gui.Button
+
+	ports           []PortInfo
+	port_updates    chan []PortInfo
+	serial_settings *SerialSettings
+	serialcfg_p     *gui.Panel
+	baud_dd         *gui.DropDown
+	parity_dd       *gui.DropDown
+	stopbits_dd     *gui.DropDown
+	dtr_cb          *gui.CheckRadio
+	rts_cb          *gui.CheckRadio
+	autocon_p       *gui.Panel
+	autocon_cb      *gui.CheckRadio
+	autocon_ed      *gui.Edit
+
+	status_l      *gui.Label
+	status        ConnState
+	status_detail string
+	link_l        *gui.Label
+	link_err_l    *gui.Label
+	link_stats    LinkStats
+
+	replay          *ReplaySource // nil unless replaying
+	replay_ed       *gui.Edit
+	replay_play_btn *gui.Button
+	replay_speed_dd *gui.DropDown
+	replay_loop_cb  *gui.CheckRadio
+	replay_sl       *gui.Slider
+	replay_set      bool // the scrubber is being moved by updateReplay
+	replay_playing  bool
+	replay_pos      float64 // seconds, as last shown
+	replay_len      float64
+
+	trail_p    *gui.Panel
+	trail_l    *gui.Label
+	trail_sl   *gui.Slider
+	histWindow float64 // seconds of trail and charts shown
 
 	graphs_tb_l      *gui.Label
 	graphs_tb        *gui.TabBar
@@ -93,6 +149,34 @@ type App struct {
 	k_yh_n  *gui.TreeNode
 	k_yh_tb *gui.Table
 
+	k_pc_hm_n *gui.TreeNode
+	k_pc_hm   *Heatmap
+	k_K_hm_n  *gui.TreeNode
+	k_K_hm    *Heatmap
+
+	// History of the heatmap cell last clicked on
+	k_el_n   *gui.TreeNode
+	k_el_l   *gui.Label
+	k_el_ch  *gui.Chart
+	k_el_g   *gui.Graph
+	k_el_mat string // "P", "K" or none
+	k_el_row int
+	k_el_col int
+
+	sess_n    *gui.TreeNode
+	sess_list *gui.List
+	sess_dirs []string // per sess_list item
+
+	tune_n      *gui.TreeNode
+	tune_ed     [][]*gui.Edit // per tuneGroups entry
+	tune_dev_l  []*gui.Label
+	tune_err_l  *gui.Label
+	tune_params *FilterParams // last shown device parameters
+	tune_load   bool          // copy the next device parameters into the edits
+
+	graphs_snap *filterState // snapshot the graphs and tables show
+	state_epoch int          // filterState.epoch the scene was drawn from
+
 	// k_tabs       *gui.TabBar
 	// k_tabs_st_tb *gui.Tab
 	// k_tabs_ci_tb *gui.Tab
@@ -108,8 +192,34 @@ type App struct {
 	vdisk   *graphic.Mesh
 	vcube   *graphic.Mesh
 
-	trail_m *material.Standard
-	trail_s []*graphic.Sprite
+	trail         *Ribbon
+	trail_seen    int  // state samples already considered, see History.Pushed
+	trail_any     bool // trail_last is set
+	trail_last    Sample[math32.Vector3]
+	trail_from    float64 // samples before the last zeroing are not drawn
+	trail_dec     int     // index into trailDecimations
+	trail_col     int     // index into trailColorings
+	trail_cmap    int     // index into colormaps
+	trail_cmin    float32 // colour range
+	trail_cmax    float32
+	trail_rescale bool // a point fell outside the colour range
+
+	legend_p     *gui.Panel
+	legend_l     *gui.Label
+	legend_bar   []*gui.Panel
+	legend_min_l *gui.Label
+	legend_max_l *gui.Label
+
+	cov         *graphic.Mesh // position covariance around the device
+	cov_g       *geometry.Geometry
+	cov_ghosts  []*graphic.Mesh // left along the trail
+	cov_ghost_m []*material.Standard
+	cov_sigma   int // index into covSigmas
+	cov_ghost   int // index into covGhostIntervals
+
+	vec_a     []*Arrow // one per sceneVectors
+	vec_on    []bool
+	vec_scale []float32 // times the vector's base scale
 
 	frameRater *util.FrameRater
 	labelFPS   *gui.Label
@@ -119,6 +229,7 @@ type App struct {
 	con                *Connector
 	pos_offset         math32.Vector3
 	pos_offset_readout []float32
+	zero_cb            *gui.CheckRadio // F5 zeroes the filter on the device
 }
 
 func Create() *App {
@@ -169,6 +280,14 @@ func Create() *App {
 	a.mainPanel.Add(pers)
 	pers.SetPosition(0, 16)
 
+	// Zero on the device instead of offsetting locally
+	a.zero_cb = gui.NewCheckBox("Zero on device (F5)")
+	a.mainPanel.Add(a.zero_cb)
+	a.zero_cb.SetPosition(0, 32)
+
+	// Trail colour scale
+	a.buildLegend(0, 52)
+
 	// window resize handler
 	a.Subscribe(window.OnWindowSize, func(evname string, ev interface{}) {
 		a.OnWindowResize()
@@ -197,26 +316,45 @@ func (a *App) onKey(evname string, ev interface{}) {
 	kev := ev.(*window.KeyEvent)
 	switch kev.Key {
 	case window.KeyF5:
-		a.pos_offset = *a.con.x_pos.MultiplyScalar(-1)
-		// a.pos_offset_readout[0] = a.con.x_pos.X / float32(a.con.posS)
-		// a.pos_offset_readout[1] = a.con.x_pos.Y / float32(a.con.posS)
-		// a.pos_offset_readout[2] = a.con.x_pos.Z / float32(a.con.posS)
-		// fmt.Printf("x_pos: %v\n", a.con.x_pos)
-		// fmt.Printf("Pos offset: %v\n", a.pos_offset.MultiplyScalar(-1/float32(a.con.posS)))
-		// panic("exit")
-		// pos -0.3 -1.2 -1.4
-		// offset -1.3 -1.4 -0.3
-		// pos_offset_scaled := a.pos_offset.MultiplyScalar(-1 / float32(a.con.posS))
-		a.pos_offset_readout[0] = -1 * a.con.x[0]
-		a.pos_offset_readout[1] = -1 * a.con.x[1]
-		a.pos_offset_readout[2] = -1 * a.con.x[2]
-
-		for i := range a.trail_s {
-			a.trail_s[i].SetPosition(0, 0, 0)
-		}
-
-		// Restart log
-		a.con.StartNewLog()
+		if a.zero_cb.Value() {
+			// The device zeroes its own state, drop any local offset
+			if evname == window.OnKeyDown {
+				if _, err := a.con.ZeroPosition(); err != nil {
+					fmt.Println("Error zeroing device:", err)
+				}
+			}
+			a.pos_offset = math32.Vector3{}
+			a.pos_offset_readout[0] = 0
+			a.pos_offset_readout[1] = 0
+			a.pos_offset_readout[2] = 0
+		} else {
+			snap := a.con.Snapshot()
+			a.pos_offset = snap.x_pos
+			a.pos_offset.MultiplyScalar(-1)
+			// a.pos_offset_readout[0] = a.con.x_pos.X / float32(a.con.posS)
+			// a.pos_offset_readout[1] = a.con.x_pos.Y / float32(a.con.posS)
+			// a.pos_offset_readout[2] = a.con.x_pos.Z / float32(a.con.posS)
+			// fmt.Printf("x_pos: %v\n", a.con.x_pos)
+			// fmt.Printf("Pos offset: %v\n", a.pos_offset.MultiplyScalar(-1/float32(a.con.posS)))
+			// panic("exit")
+			// pos -0.3 -1.2 -1.4
+			// offset -1.3 -1.4 -0.3
+			// pos_offset_scaled := a.pos_offset.MultiplyScalar(-1 / float32(a.con.posS))
+			a.pos_offset_readout[0] = -1 * snap.x[0]
+			a.pos_offset_readout[1] = -1 * snap.x[1]
+			a.pos_offset_readout[2] = -1 * snap.x[2]
+		}
+
+		// Start a fresh trail from the new zero point
+		snap := a.con.Snapshot()
+		a.trail_from = snap.t
+		a.rebuildTrail(snap)
+
+		// Restart log, once per key press
+		if evname == window.OnKeyDown {
+			a.con.StartNewLog()
+			a.refreshSessions()
+		}
 		// a.con.WriteHeader()
 	}
 }
@@ -257,17 +395,15 @@ func (a *App) setupScene() {
 	a.vcube.SetPosition(0, 0, 0.25)
 	a.vdisk.Add(a.vcube)
 
-	// Create a trail sprites
-	a.trail_m = material.NewStandard(&math32.Color{R: 0, G: 1, B: 1})
-	a.trail_m.SetTransparent(true)
-	a.trail_m.SetOpacity(0.5)
-	// a.trail_m.SetEmissiveColor(&math32.Color{R: 0, G: 1, B: 1})
-	a.trail_s = make([]*graphic.Sprite, historySize)
-	for i := 0; i < historySize; i++ {
-		a.trail_s[i] = graphic.NewSprite(0.2, 0.1, a.trail_m)
-		a.trail_s[i].SetPosition(0, 0, 0)
-		a.scene.Add(a.trail_s[i])
-	}
+	// Create the trail, as long as the history it is drawn from
+	a.trail = NewRibbon(historySize, trailWidth, trailOpacity)
+	a.scene.Add(a.trail)
+
+	// Create the covariance ellipsoids
+	a.setupCovariance()
+
+	// Create the device arrows
+	a.setupVectors()
 
 }
 
@@ -314,7 +450,6 @@ func (a *App) buildGUI() {
 	a.footer.Add(a.srm)
 
 	//? link!
-	a.con.setScroller(a.srm)
 	a.con.setUpdateGraphsFunc(a.updateGraphs, historySize, posScale)
 
 	// Graph & Table sidebar
@@ -332,6 +467,44 @@ func (a *App) buildGUI() {
 	sidebar_v.SetAlignV(gui.AlignTop)
 	a.sidebar.SetLayout(sidebar_v)
 
+	// Transport selector
+	transport_hb := gui.NewHBoxLayout()
+	transport_hb.SetAlignH(gui.AlignLeft)
+	transport_hb.SetAutoWidth(false)
+	transport_hb.SetSpacing(5)
+	a.transport_p = gui.NewPanel(a.sidebar.Width(), 18)
+	a.transport_p.SetLayout(transport_hb)
+	a.sidebar.Add(a.transport_p)
+	a.transport_l = gui.NewLabel("Transport: ")
+	a.transport_p.Add(a.transport_l)
+	a.transport_dd = gui.NewDropDown(120, gui.NewImageLabel(transportSerial))
+	for _, t := range []string{transportSerial, transportTCPClient, transportTCPServer, transportUDP} {
+		a.transport_dd.Add(gui.NewImageLabel(t))
+	}
+	a.transport_dd.SelectPos(0)
+	a.transport_p.Add(a.transport_dd)
+	a.transport_ed = gui.NewEdit(int(a.transport_p.Width()-a.transport_l.Width()-a.transport_dd.Width()-18), "host:port")
+	a.transport_ed.SetText(defaultTCPAddr)
+	a.transport_p.Add(a.transport_ed)
+	a.transport_p.SetHeight(a.transport_dd.Height())
+
+	// Wire format selector
+	format_hb := gui.NewHBoxLayout()
+	format_hb.SetAlignH(gui.AlignLeft)
+	format_hb.SetAutoWidth(false)
+	format_hb.SetSpacing(5)
+	format_p := gui.NewPanel(a.sidebar.Width(), 18)
+	format_p.SetLayout(format_hb)
+	a.sidebar.Add(format_p)
+	format_p.Add(gui.NewLabel("Format: "))
+	a.format_dd = gui.NewDropDown(120, gui.NewImageLabel(""))
+	for _, f := range wireFormatNames {
+		a.format_dd.Add(gui.NewImageLabel(f))
+	}
+	a.format_dd.SelectPos(int(FormatAuto))
+	format_p.Add(a.format_dd)
+	format_p.SetHeight(a.format_dd.Height())
+
 	// Serial port selector
 	serial_hb := gui.NewHBoxLayout()
 	serial_hb.SetAlignH(gui.AlignLeft)
@@ -346,31 +519,118 @@ func (a *App) buildGUI() {
 	a.serial_p.Add(a.serial_dd)
 	a.serial_btn = gui.NewButton("Connect")
 	a.serial_btn.SetHeight(a.serial_dd.Height())
-	a.serial_dd.SetWidth(a.serial_p.Width() - a.serial_l.Width() - a.serial_btn.Width() - 18)
+	a.discon_btn = gui.NewButton("Disconnect")
+	a.discon_btn.SetHeight(a.serial_dd.Height())
+	a.serial_dd.SetWidth(a.serial_p.Width() - a.serial_l.Width() - a.serial_btn.Width() - a.discon_btn.Width() - 23)
 	a.serial_p.Add(a.serial_btn)
+	a.serial_p.Add(a.discon_btn)
 	a.serial_p.SetHeight(a.serial_dd.Height())
-	// Refresh ports
-	go func() {
-		time.Sleep(1 * time.Second)
-		ports := a.con.GetPorts()
-		// a.serial_dd.DisposeChildren(false)
-		for i, p := range ports {
-			a.serial_dd.Add(gui.NewImageLabel(p))
-			a.srm.Add(gui.NewImageLabel("Found serial port: " + p))
-			a.serial_dd.SetSelected(a.serial_dd.ItemAt(i))
-			// Auto-Connect
-			time.Sleep(200 * time.Millisecond)
-			a.con.ConnectPort(p)
+	// Serial line settings
+	a.serial_settings = loadSerialSettings()
+	serialcfg_hb := gui.NewHBoxLayout()
+	serialcfg_hb.SetAlignH(gui.AlignLeft)
+	serialcfg_hb.SetAutoWidth(false)
+	serialcfg_hb.SetSpacing(5)
+	a.serialcfg_p = gui.NewPanel(a.sidebar.Width(), 18)
+	a.serialcfg_p.SetLayout(serialcfg_hb)
+	a.sidebar.Add(a.serialcfg_p)
+	a.serialcfg_p.Add(gui.NewLabel("Baud: "))
+	a.baud_dd = gui.NewDropDown(72, gui.NewImageLabel(""))
+	for _, b := range serialBaudRates {
+		a.baud_dd.Add(gui.NewImageLabel(fmt.Sprintf("%d", b)))
+	}
+	a.serialcfg_p.Add(a.baud_dd)
+	a.serialcfg_p.Add(gui.NewLabel("Parity: "))
+	a.parity_dd = gui.NewDropDown(56, gui.NewImageLabel(""))
+	for _, p := range serialParities {
+		a.parity_dd.Add(gui.NewImageLabel(p))
+	}
+	a.serialcfg_p.Add(a.parity_dd)
+	a.serialcfg_p.Add(gui.NewLabel("Stop: "))
+	a.stopbits_dd = gui.NewDropDown(40, gui.NewImageLabel(""))
+	for _, sb := range serialStopBits {
+		a.stopbits_dd.Add(gui.NewImageLabel(sb))
+	}
+	a.serialcfg_p.Add(a.stopbits_dd)
+	a.dtr_cb = gui.NewCheckBox("DTR")
+	a.serialcfg_p.Add(a.dtr_cb)
+	a.rts_cb = gui.NewCheckBox("RTS")
+	a.serialcfg_p.Add(a.rts_cb)
+	a.serialcfg_p.SetHeight(a.baud_dd.Height())
+	a.showSerialConfig(DefaultSerialConfig())
+	// Show the remembered settings of the selected device
+	a.serial_dd.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if port, ok := a.selectedPort(); ok {
+			a.showSerialConfig(a.serialConfigFor(port))
 		}
-	}()
+	})
+
+	// Auto-connect, restricted to one USB VID:PID
+	autocon_hb := gui.NewHBoxLayout()
+	autocon_hb.SetAlignH(gui.AlignLeft)
+	autocon_hb.SetAutoWidth(false)
+	autocon_hb.SetSpacing(5)
+	a.autocon_p = gui.NewPanel(a.sidebar.Width(), 18)
+	a.autocon_p.SetLayout(autocon_hb)
+	a.sidebar.Add(a.autocon_p)
+	a.autocon_cb = gui.NewCheckBox("Auto-connect VID:PID")
+	a.autocon_cb.SetValue(a.serial_settings.AutoConnect)
+	a.autocon_p.Add(a.autocon_cb)
+	a.autocon_ed = gui.NewEdit(96, "303A:1001")
+	a.autocon_ed.SetText(a.serial_settings.AutoConnectID)
+	a.autocon_p.Add(a.autocon_ed)
+	a.autocon_p.SetHeight(a.autocon_ed.Height())
+	a.autocon_cb.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		a.serial_settings.AutoConnect = a.autocon_cb.Value()
+		a.serial_settings.AutoConnectID = a.autocon_ed.Text()
+		a.serial_settings.save()
+	})
+	a.autocon_ed.Subscribe(gui.OnFocusLost, func(evname string, ev interface{}) {
+		a.serial_settings.AutoConnectID = a.autocon_ed.Text()
+		a.serial_settings.save()
+	})
+
+	// Refresh ports
+	a.port_updates = make(chan []PortInfo, 1)
+	go a.watchPorts()
 	// Set port
 	a.serial_btn.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
-		port := a.serial_dd.Selected()
-		if port == nil {
-			return
+		switch a.transport_dd.Selected().Text() {
+		case transportTCPClient:
+			a.con.Connect(NewTCPClientSource(a.transport_ed.Text(), a.wireFormat()))
+		case transportTCPServer:
+			a.con.Connect(NewTCPServerSource(a.transport_ed.Text(), a.wireFormat()))
+		case transportUDP:
+			a.con.Connect(NewUDPSource(a.transport_ed.Text(), a.wireFormat()))
+		default:
+			port, ok := a.selectedPort()
+			if !ok {
+				return
+			}
+			// Remember the settings for this device
+			config := a.serialConfig()
+			a.serial_settings.Devices[port.Key()] = config
+			a.serial_settings.save()
+			a.con.ConnectPort(port.Name, config, a.wireFormat())
 		}
-		a.con.ConnectPort(port.Text())
 	})
+	a.discon_btn.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		a.con.Disconnect()
+	})
+
+	// Connection status
+	a.status_l = gui.NewLabel("Status: Idle")
+	a.sidebar.Add(a.status_l)
+
+	// Link statistics
+	a.link_l = gui.NewLabel("Link: " + a.link_stats.String())
+	a.sidebar.Add(a.link_l)
+	a.link_err_l = gui.NewLabel("")
+	a.link_err_l.SetColor(&math32.Color{R: 1, G: 0.5, B: 0.5})
+	a.sidebar.Add(a.link_err_l)
+
+	// Replay of recorded sessions
+	a.buildReplay()
 
 	// Trail slider
 	trail_hb := gui.NewHBoxLayout()
@@ -383,17 +643,144 @@ func (a *App) buildGUI() {
 	a.trail_l = gui.NewLabel("Trail Length: ")
 	a.trail_p.Add(a.trail_l)
 	a.trail_sl = gui.NewHSlider(a.sidebar.Width()-a.trail_l.Width()-15, a.trail_l.Height())
-	a.trail_sl.SetValue(1)
-	a.histShow = historySize
-	a.trail_sl.SetText(fmt.Sprintf("%d frames", int(a.trail_sl.Value()*historySize)))
+	// Quadratic so that short windows get most of the slider
+	a.trail_sl.SetValue(float32(math.Sqrt(defaultWindow / historySeconds)))
+	a.histWindow = defaultWindow
+	a.trail_sl.SetText(fmt.Sprintf("last %.1f s", a.histWindow))
 	a.trail_sl.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
 		// process change
-		a.histShow = int(a.trail_sl.Value() * historySize)
-		a.trail_sl.SetText(fmt.Sprintf("%d frames", a.histShow))
+		v := float64(a.trail_sl.Value())
+		a.histWindow = v * v * historySeconds
+		a.trail_sl.SetText(fmt.Sprintf("last %.1f s", a.histWindow))
+		a.rebuildTrail(a.con.Snapshot())
+		a.setChartWindow()
+		a.graphs_snap = nil // redraw the charts
 	})
 	a.trail_p.Add(a.trail_sl)
 	a.trail_p.SetHeight(a.trail_sl.Height())
 
+	// Trail decimation
+	trail_dec_hb := gui.NewHBoxLayout()
+	trail_dec_hb.SetAlignH(gui.AlignLeft)
+	trail_dec_hb.SetAutoWidth(false)
+	trail_dec_hb.SetSpacing(5)
+	trail_dec_p := gui.NewPanel(a.sidebar.Width(), 18)
+	trail_dec_p.SetLayout(trail_dec_hb)
+	a.sidebar.Add(trail_dec_p)
+	trail_dec_p.Add(gui.NewLabel("Trail Spacing: "))
+	trail_dec_dd := gui.NewDropDown(120, gui.NewImageLabel(""))
+	for _, d := range trailDecimations {
+		trail_dec_dd.Add(gui.NewImageLabel(d.name))
+	}
+	trail_dec_dd.SelectPos(0)
+	trail_dec_dd.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if pos := trail_dec_dd.SelectedPos(); pos >= 0 {
+			a.trail_dec = pos
+			a.rebuildTrail(a.con.Snapshot())
+		}
+	})
+	trail_dec_p.Add(trail_dec_dd)
+	trail_dec_p.SetHeight(trail_dec_dd.Height())
+
+	// Trail colouring
+	trail_col_hb := gui.NewHBoxLayout()
+	trail_col_hb.SetAlignH(gui.AlignLeft)
+	trail_col_hb.SetAutoWidth(false)
+	trail_col_hb.SetSpacing(5)
+	trail_col_p := gui.NewPanel(a.sidebar.Width(), 18)
+	trail_col_p.SetLayout(trail_col_hb)
+	a.sidebar.Add(trail_col_p)
+	trail_col_p.Add(gui.NewLabel("Trail Colour: "))
+	trail_col_dd := gui.NewDropDown(170, gui.NewImageLabel(""))
+	for _, c := range trailColorings {
+		trail_col_dd.Add(gui.NewImageLabel(c.name))
+	}
+	trail_col_dd.SelectPos(0)
+	trail_col_dd.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if pos := trail_col_dd.SelectedPos(); pos >= 0 {
+			a.trail_col = pos
+			a.rebuildTrail(a.con.Snapshot())
+		}
+	})
+	trail_col_p.Add(trail_col_dd)
+	trail_cmap_dd := gui.NewDropDown(90, gui.NewImageLabel(""))
+	for _, m := range colormaps {
+		trail_cmap_dd.Add(gui.NewImageLabel(m.name))
+	}
+	trail_cmap_dd.SelectPos(0)
+	trail_cmap_dd.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if pos := trail_cmap_dd.SelectedPos(); pos >= 0 {
+			a.trail_cmap = pos
+			a.rebuildTrail(a.con.Snapshot())
+		}
+	})
+	trail_col_p.Add(trail_cmap_dd)
+	trail_col_p.SetHeight(trail_col_dd.Height())
+
+	// Trail width and fading
+	trail_w_hb := gui.NewHBoxLayout()
+	trail_w_hb.SetAlignH(gui.AlignLeft)
+	trail_w_hb.SetAutoWidth(false)
+	trail_w_hb.SetSpacing(5)
+	trail_w_p := gui.NewPanel(a.sidebar.Width(), 16)
+	trail_w_p.SetLayout(trail_w_hb)
+	a.sidebar.Add(trail_w_p)
+	trail_w_l := gui.NewLabel("Trail Width: ")
+	trail_w_p.Add(trail_w_l)
+	trail_fade_cb := gui.NewCheckBox("Fade")
+	trail_fade_cb.SetValue(true)
+	trail_fade_cb.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		a.trail.SetFade(trail_fade_cb.Value())
+	})
+	trail_w_sl := gui.NewHSlider(a.sidebar.Width()-trail_w_l.Width()-trail_fade_cb.Width()-20, trail_w_l.Height())
+	trail_w_sl.SetValue(trailWidth / trailMaxWidth)
+	trail_w_sl.SetText(fmt.Sprintf("%.2f cm", trailWidth))
+	trail_w_sl.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		w := trail_w_sl.Value() * trailMaxWidth
+		trail_w_sl.SetText(fmt.Sprintf("%.2f cm", w))
+		a.trail.SetWidth(w)
+	})
+	trail_w_p.Add(trail_w_sl)
+	trail_w_p.Add(trail_fade_cb)
+	trail_w_p.SetHeight(trail_w_sl.Height())
+
+	// Covariance ellipsoids
+	cov_hb := gui.NewHBoxLayout()
+	cov_hb.SetAlignH(gui.AlignLeft)
+	cov_hb.SetAutoWidth(false)
+	cov_hb.SetSpacing(5)
+	cov_p := gui.NewPanel(a.sidebar.Width(), 18)
+	cov_p.SetLayout(cov_hb)
+	a.sidebar.Add(cov_p)
+	cov_p.Add(gui.NewLabel("Covariance: "))
+	cov_sigma_dd := gui.NewDropDown(80, gui.NewImageLabel(""))
+	for _, s := range covSigmas {
+		cov_sigma_dd.Add(gui.NewImageLabel(s.name))
+	}
+	cov_sigma_dd.SelectPos(0)
+	cov_sigma_dd.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if pos := cov_sigma_dd.SelectedPos(); pos >= 0 {
+			a.cov_sigma = pos
+		}
+	})
+	cov_p.Add(cov_sigma_dd)
+	cov_p.Add(gui.NewLabel("Along trail every: "))
+	cov_ghost_dd := gui.NewDropDown(70, gui.NewImageLabel(""))
+	for _, g := range covGhostIntervals {
+		cov_ghost_dd.Add(gui.NewImageLabel(g.name))
+	}
+	cov_ghost_dd.SelectPos(0)
+	cov_ghost_dd.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if pos := cov_ghost_dd.SelectedPos(); pos >= 0 {
+			a.cov_ghost = pos
+		}
+	})
+	cov_p.Add(cov_ghost_dd)
+	cov_p.SetHeight(cov_sigma_dd.Height())
+
+	// Device arrows
+	a.buildVectors()
+
 	// Graphs
 	a.graphs_tb_l = gui.NewLabel("Sensor Data: ")
 	a.sidebar.Add(a.graphs_tb_l)
@@ -419,6 +806,8 @@ func (a *App) buildGUI() {
 	a.graph_imu_accel.SetScaleY(11, &math32.Color{R: 0.8, G: 0.8, B: 0.8})
 	a.graph_imu_accel.SetFontSizeX(12)
 	a.graph_imu_accel.SetFormatY("%2.1f")
+	a.graph_imu_accel.SetFormatX("%.1fs")
+	a.graph_imu_accel.SetScaleX(chartScaleLines, &math32.Color{R: 0.8, G: 0.8, B: 0.8})
 	a.graphs_accel_tab.SetContent(a.graph_imu_accel)
 
 	// orientation graph
@@ -435,6 +824,8 @@ func (a *App) buildGUI() {
 	a.graph_imu_orio.SetScaleY(9, &math32.Color{R: 0.8, G: 0.8, B: 0.8})
 	a.graph_imu_orio.SetFontSizeX(12)
 	a.graph_imu_orio.SetFormatY("%2.1f")
+	a.graph_imu_orio.SetFormatX("%.1fs")
+	a.graph_imu_orio.SetScaleX(chartScaleLines, &math32.Color{R: 0.8, G: 0.8, B: 0.8})
 	a.graphs_orio_tab.SetContent(a.graph_imu_orio)
 
 	// OF graph
@@ -451,6 +842,8 @@ func (a *App) buildGUI() {
 	a.graph_of_delta.SetScaleY(11, &math32.Color{R: 0.8, G: 0.8, B: 0.8})
 	a.graph_of_delta.SetFontSizeX(12)
 	a.graph_of_delta.SetFormatY("%2.1f")
+	a.graph_of_delta.SetFormatX("%.1fs")
+	a.graph_of_delta.SetScaleX(chartScaleLines, &math32.Color{R: 0.8, G: 0.8, B: 0.8})
 	a.graph_of_delta.SetRangeYauto(true)
 	a.graphs_of_tab.SetContent(a.graph_of_delta)
 
@@ -542,7 +935,7 @@ func (a *App) buildGUI() {
 	a.k_pc_tb.SetRows(k_pc_vals)
 	a.k_pc_tb.ShowHeader(false)
 	a.k_pc_n.Add(a.k_pc_tb)
-	a.k_pc_n.SetExpanded(true)
+	a.k_pc_n.SetExpanded(false)
 
 	// Kalman State Transisiton
 	a.k_oc_n = a.kalman_p_t1.AddNode("State Transition (f)")
@@ -588,7 +981,7 @@ func (a *App) buildGUI() {
 	a.k_K_tb.SetRows(k_K_vals)
 	a.k_K_tb.ShowHeader(false)
 	a.k_K_n.Add(a.k_K_tb)
-	a.k_K_n.SetExpanded(true)
+	a.k_K_n.SetExpanded(false)
 
 	// Kalman Innovation
 	a.k_yh_n = a.kalman_p_t1.AddNode("Innovation (y-h)")
@@ -609,6 +1002,16 @@ func (a *App) buildGUI() {
 	a.k_yh_n.Add(a.k_yh_tb)
 	a.k_yh_n.SetExpanded(true)
 
+	// P and K heatmaps
+	a.buildHeatmaps()
+	a.setChartWindow()
+
+	// Kalman tuning
+	a.buildTuning()
+
+	// Recorded log sessions
+	a.buildSessions()
+
 	/*
 		// Bottom Row fixed matrices
 		a.k_tabs = gui.NewTabBar(a.kalman_p_s2.ContentWidth(), a.kalman_p_s2.P1.ContentHeight())
@@ -639,8 +1042,171 @@ func (a *App) buildGUI() {
 	})
 }
 
+// watchPorts scans for serial ports in the background, handing changed
+// lists to the render loop
+func (a *App) watchPorts() {
+	var last []PortInfo
+	for {
+		ports := a.con.GetPorts()
+		if !samePorts(ports, last) {
+			last = ports
+			a.port_updates <- ports
+		}
+		time.Sleep(portScanInterval)
+	}
+}
+
+// updatePorts keeps the port selector in sync with the system, connecting
+// the configured auto-connect device when it appears
+func (a *App) updatePorts() {
+	select {
+	case ports := <-a.port_updates:
+		previous := a.ports
+		a.setPorts(ports)
+		for i, p := range ports {
+			if containsPort(previous, p) {
+				continue
+			}
+			a.srm.Add(gui.NewImageLabel("Found serial port: " + p.Label()))
+			if a.serial_settings.Matches(p) && !a.con.HasActive() {
+				a.serial_dd.SelectPos(i)
+				a.con.ConnectPort(p.Name, a.serialConfigFor(p), a.wireFormat())
+			}
+		}
+	default:
+	}
+}
+
+// showNotices adds the connector's queued messages to the serial monitor
+func (a *App) showNotices() {
+	notices := a.con.Notices()
+	for _, n := range notices {
+		a.srm.Add(gui.NewImageLabel(n))
+	}
+	if len(notices) > 0 {
+		a.srm.ScrollDown()
+	}
+}
+
+// setPorts replaces the selector entries, keeping the selected device
+func (a *App) setPorts(ports []PortInfo) {
+	selected, hasSelected := a.selectedPort()
+	for a.serial_dd.Len() > 0 {
+		a.serial_dd.RemoveAt(0)
+	}
+	a.ports = ports
+	for _, p := range ports {
+		a.serial_dd.Add(gui.NewImageLabel(p.Label()))
+	}
+	for i, p := range ports {
+		if hasSelected && p.Key() == selected.Key() {
+			a.serial_dd.SelectPos(i)
+			return
+		}
+	}
+	if len(ports) > 0 {
+		a.serial_dd.SelectPos(0)
+	}
+}
+
+func containsPort(ports []PortInfo, port PortInfo) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+func samePorts(a, b []PortInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *App) wireFormat() WireFormat {
+	if pos := a.format_dd.SelectedPos(); pos >= 0 {
+		return WireFormat(pos)
+	}
+	return FormatAuto
+}
+
+func (a *App) selectedPort() (PortInfo, bool) {
+	pos := a.serial_dd.SelectedPos()
+	if pos < 0 || pos >= len(a.ports) {
+		return PortInfo{}, false
+	}
+	return a.ports[pos], true
+}
+
+func (a *App) serialConfigFor(port PortInfo) SerialConfig {
+	if config, ok := a.serial_settings.Devices[port.Key()]; ok {
+		return config
+	}
+	return DefaultSerialConfig()
+}
+
+// serialConfig reads the line settings from the sidebar controls
+func (a *App) serialConfig() SerialConfig {
+	config := DefaultSerialConfig()
+	if pos := a.baud_dd.SelectedPos(); pos >= 0 {
+		config.Baud = serialBaudRates[pos]
+	}
+	if pos := a.parity_dd.SelectedPos(); pos >= 0 {
+		config.Parity = serial.Parity(pos)
+	}
+	if pos := a.stopbits_dd.SelectedPos(); pos >= 0 {
+		config.StopBits = serial.StopBits(pos)
+	}
+	config.DTR = a.dtr_cb.Value()
+	config.RTS = a.rts_cb.Value()
+	return config
+}
+
+func (a *App) showSerialConfig(config SerialConfig) {
+	for i, b := range serialBaudRates {
+		if b == config.Baud {
+			a.baud_dd.SelectPos(i)
+		}
+	}
+	a.parity_dd.SelectPos(int(config.Parity))
+	a.stopbits_dd.SelectPos(int(config.StopBits))
+	a.dtr_cb.SetValue(config.DTR)
+	a.rts_cb.SetValue(config.RTS)
+}
+
 func (a *App) updateGraphs() {
-	if !a.con.rso {
+	// Connection status
+	if state, detail := a.con.Status(); state != a.status || detail != a.status_detail {
+		a.status, a.status_detail = state, detail
+		if detail != "" {
+			a.status_l.SetText(fmt.Sprintf("Status: %s (%s)", state, detail))
+		} else {
+			a.status_l.SetText(fmt.Sprintf("Status: %s", state))
+		}
+	}
+
+	// Link statistics, only redrawn when they change
+	if stats := a.con.LinkStats(); stats != a.link_stats {
+		a.link_stats = stats
+		a.link_l.SetText("Link: " + stats.String())
+		if stats.LastError != "" {
+			a.link_err_l.SetText("Last invalid message: " + stats.LastError)
+		}
+	}
+
+	a.updateTuning()
+
+	// Redraw only when a new snapshot was published
+	if snap := a.con.Snapshot(); snap != a.graphs_snap {
+		a.graphs_snap = snap
+
 		// Linear Acceleration
 		if a.lacel_x != nil {
 			a.graph_imu_accel.RemoveGraph(a.lacel_x)
@@ -654,15 +1220,7 @@ func (a *App) updateGraphs() {
 			a.graph_imu_accel.RemoveGraph(a.lacel_z)
 			a.lacel_z = nil
 		}
-		var lacel_x_d, lacel_y_d, lacel_z_d []float32
-		for i := 0; i < len(a.con.lin_accel_a); i++ {
-			lacel_x_d = append(lacel_x_d, a.con.lin_accel_a[i].X)
-			lacel_y_d = append(lacel_y_d, a.con.lin_accel_a[i].Y)
-			lacel_z_d = append(lacel_z_d, a.con.lin_accel_a[i].Z)
-			if i == a.histShow {
-				break
-			}
-		}
+		lacel_x_d, lacel_y_d, lacel_z_d := chartSeries(snap.lin_accel_a, snap.t, a.histWindow)
 		a.lacel_x = a.graph_imu_accel.AddLineGraph(&math32.Color{R: 1, G: 0, B: 0}, lacel_x_d)
 		a.lacel_y = a.graph_imu_accel.AddLineGraph(&math32.Color{R: 0, G: 1, B: 0}, lacel_y_d)
 		a.lacel_z = a.graph_imu_accel.AddLineGraph(&math32.Color{R: 0, G: 0, B: 1}, lacel_z_d)
@@ -680,15 +1238,7 @@ func (a *App) updateGraphs() {
 			a.graph_imu_orio.RemoveGraph(a.orio_z)
 			a.orio_z = nil
 		}
-		var orio_x_d, orio_y_d, orio_z_d []float32
-		for i := 0; i < len(a.con.orin_e_a); i++ {
-			orio_x_d = append(orio_x_d, a.con.orin_e_a[i].X)
-			orio_y_d = append(orio_y_d, a.con.orin_e_a[i].Z) // swap Y and Z
-			orio_z_d = append(orio_z_d, a.con.orin_e_a[i].Y)
-			if i == a.histShow {
-				break
-			}
-		}
+		orio_x_d, orio_z_d, orio_y_d := chartSeries(snap.orin_e_a, snap.t, a.histWindow) // swap Y and Z
 		a.orio_x = a.graph_imu_orio.AddLineGraph(&math32.Color{R: 1, G: 0, B: 0}, orio_x_d)
 		a.orio_y = a.graph_imu_orio.AddLineGraph(&math32.Color{R: 0, G: 1, B: 0}, orio_y_d)
 		a.orio_z = a.graph_imu_orio.AddLineGraph(&math32.Color{R: 0, G: 0, B: 1}, orio_z_d)
@@ -706,15 +1256,7 @@ func (a *App) updateGraphs() {
 			a.graph_of_delta.RemoveGraph(a.of_z)
 			a.of_z = nil
 		}
-		var of_x_d, of_y_d, of_z_d []float32
-		for i := 0; i < len(a.con.of_d_a); i++ {
-			of_x_d = append(of_x_d, a.con.of_d_a[i].X)
-			of_y_d = append(of_y_d, a.con.of_d_a[i].Y)
-			of_z_d = append(of_z_d, a.con.of_d_a[i].Z)
-			if i == a.histShow {
-				break
-			}
-		}
+		of_x_d, of_y_d, of_z_d := chartSeries(snap.of_d_a, snap.t, a.histWindow)
 		a.of_x = a.graph_of_delta.AddLineGraph(&math32.Color{R: 1, G: 0, B: 0}, of_x_d)
 		a.of_y = a.graph_of_delta.AddLineGraph(&math32.Color{R: 0, G: 1, B: 0}, of_y_d)
 		a.of_z = a.graph_of_delta.AddLineGraph(&math32.Color{R: 0, G: 0, B: 1}, of_z_d)
@@ -732,22 +1274,22 @@ func (a *App) updateGraphs() {
 		state_vals := make([]map[string]interface{}, 0, 6)
 		for i := 0; i < 6; i++ {
 			rval := make(map[string]interface{})
-			// rval["1"] = a.con.x[i]
+			// rval["1"] = snap.x[i]
 			// add in offset and set 1st column
 
 			if i < 3 {
-				rval["1"] = a.con.x[i] + a.pos_offset_readout[i]
+				rval["1"] = snap.x[i] + a.pos_offset_readout[i]
 			} else {
-				rval["1"] = a.con.x[i]
+				rval["1"] = snap.x[i]
 			}
 
 			rval["2"] = state_params[i]
 			state_vals = append(state_vals, rval)
 
 		}
-		// state_vals[0]["1"] = a.con.x[0] + a.pos_offset.X
-		// state_vals[1]["1"] = a.con.x[1] + a.pos_offset.Y
-		// state_vals[2]["1"] = a.con.x[2] + a.pos_offset.Z
+		// state_vals[0]["1"] = snap.x[0] + a.pos_offset.X
+		// state_vals[1]["1"] = snap.x[1] + a.pos_offset.Y
+		// state_vals[2]["1"] = snap.x[2] + a.pos_offset.Z
 		a.k_state_tb.SetRows(state_vals)
 
 		// State Covariance Table
@@ -755,7 +1297,7 @@ func (a *App) updateGraphs() {
 		for i := 0; i < 6; i++ {
 			rval := make(map[string]interface{})
 			for j := 0; j < 6; j++ {
-				rval[fmt.Sprintf("%d", j+1)] = a.con.P[i*6+j]
+				rval[fmt.Sprintf("%d", j+1)] = snap.P[i*6+j]
 			}
 			k_pc_vals = append(k_pc_vals, rval)
 		}
@@ -765,7 +1307,7 @@ func (a *App) updateGraphs() {
 		k_oc_vals := make([]map[string]interface{}, 0, 6)
 		for i := 0; i < 6; i++ {
 			rval := make(map[string]interface{})
-			rval["1"] = a.con.f[i]
+			rval["1"] = snap.f[i]
 			k_oc_vals = append(k_oc_vals, rval)
 		}
 		a.k_oc_tb.SetRows(k_oc_vals)
@@ -775,7 +1317,7 @@ func (a *App) updateGraphs() {
 		for i := 0; i < 3; i++ {
 			rval := make(map[string]interface{})
 			for j := 0; j < 6; j++ {
-				rval[fmt.Sprintf("%d", j+1)] = a.con.K[i*6+j]
+				rval[fmt.Sprintf("%d", j+1)] = snap.K[i*6+j]
 			}
 			k_K_vals = append(k_K_vals, rval)
 		}
@@ -785,22 +1327,49 @@ func (a *App) updateGraphs() {
 		k_yh_vals := make([]map[string]interface{}, 0, 3)
 		for i := 0; i < 3; i++ {
 			rval := make(map[string]interface{})
-			rval["1"] = a.con.yh[i]
+			rval["1"] = snap.yh[i]
 			k_yh_vals = append(k_yh_vals, rval)
 		}
 		a.k_yh_tb.SetRows(k_yh_vals)
 
+		a.updateHeatmaps(snap)
 	}
 }
 
+// chartSeries returns the x, y and z lines of h over the window seconds
+// ending at end, oldest first on a uniform time grid
+func chartSeries(h *History[Sample[math32.Vector3]], end, window float64) (xs, ys, zs []float32) {
+	for _, v := range resampleVec(h, end-window, end, graphPoints) {
+		xs = append(xs, v.X)
+		ys = append(ys, v.Y)
+		zs = append(zs, v.Z)
+	}
+	return xs, ys, zs
+}
+
+// setChartWindow labels the chart X axes in seconds before the last sample
+func (a *App) setChartWindow() {
+	first := float32(-a.histWindow)
+	step := float32(a.histWindow / chartScaleLines)
+	count := float32(graphPoints-1) / chartScaleLines
+	a.graph_imu_accel.SetRangeX(first, step, count)
+	a.graph_imu_orio.SetRangeX(first, step, count)
+	a.graph_of_delta.SetRangeX(first, step, count)
+	a.k_el_ch.SetRangeX(first, step, count)
+}
+
 func (a *App) Run() {
 	a.Application.Run(a.Update)
+	a.con.CloseLog()
 }
 
 func (a *App) Update(rend *renderer.Renderer, deltaTime time.Duration) {
 	// Start measuring this frame
 	a.frameRater.Start()
 
+	a.showNotices()
+	a.updatePorts()
+	a.updateReplay()
 	a.updateGraphs()
 
 	// Clear the color, depth and stencil buffers
@@ -857,62 +1426,26 @@ func (a *App) updateViz(deltaTime time.Duration) {
 		)
 	*/
 
-	// If we are connected to the device, update the 3D scene
-	if !a.con.rso {
-		// Get the current position, subtracting the zero point offset
-		currentPos := a.con.x_pos.Add(&a.pos_offset)
-		// Set the position and orientation of the device visual
-		a.vdisk.SetRotationQuat(&a.con.orin)
-		a.vdisk.SetPositionVec(currentPos)
-
-		// var x, z float32
-		// x, z = 0.0, 0.0
-		// Update the trail sprites, moving them back according to the history buffer
-		for i := len(a.trail_s) - 1; i > 0; i-- {
-			// Retrieve and set the position
-			pos := a.trail_s[i-1].Position()
-			a.trail_s[i].SetPositionVec(&pos)
-			// Retrieve and set the rotation
-			rot := a.trail_s[i-1].Rotation()
-			a.trail_s[i].SetRotationVec(&rot)
-
-			// Hide sprites older than the specified history size
-			if i <= a.histShow {
-				a.trail_s[i].SetVisible(true)
-			} else {
-				a.trail_s[i].SetVisible(false)
-			}
-		}
-		// a.trail_s[0].SetPosition(x, 0, z)
-		// a.trail_s[0].RotateZ(0.01)
-
-		// Set the position and rotation of the current position trail sprite
-		a.trail_s[0].SetPositionVec(currentPos)
-		a.trail_s[0].SetRotationQuat(&a.con.orin)
-
-		// Update the tail sprite colours based on velocity
-		/*
-			for i := 0; i < len(a.trail_s)-1; i++ {
-				// Calculate velocity
-				currentPos := a.trail_s[i].Position()
-				nextPos := a.trail_s[i+1].Position()
-				delta := math32.Abs(currentPos.DistanceTo(&nextPos))
-				vel := delta / float32(1.0/100)
-				fmt.Printf("delta: %v, vel: %v\n", delta, vel)
-				// Set the colour based on velocity
-				maxVel := 10
-				velScale := vel / float32(maxVel)
-				if velScale > 1.0 {
-					velScale = 1.0
-				}
-				// fmt.Printf("velScale: %v\n", velScale)
-				r, g, b, _ := colorconv.HSLToRGB(float64(velScale), 1.0, 1.0)
-				// fmt.Printf("r: %v, g: %v, b: %v\n", r, g, b)
-
-				// a.trail_s[i].GetMaterial(0).Dispose()
-				a.trail_s[i].AddMaterial(a.trail_s[i], material.NewStandard(&math32.Color{R: float32(r / 255.0), G: float32(g / 255.0), B: float32(b / 255.0)}), 0, 0)
-			}
-		*/
-
+	// Show the latest state published by the connector
+	snap := a.con.Snapshot()
+	// Get the current position, subtracting the zero point offset
+	currentPos := snap.x_pos
+	currentPos.Add(&a.pos_offset)
+	// Set the position and orientation of the device visual
+	a.vdisk.SetRotationQuat(&snap.orin)
+	a.vdisk.SetPositionVec(&currentPos)
+
+	// A replay jumped back, the old trail is on another timeline
+	if snap.epoch != a.state_epoch {
+		a.state_epoch = snap.epoch
+		a.trail_from = 0
+		a.rebuildTrail(snap)
 	}
+
+	// var x, z float32
+	// x, z = 0.0, 0.0
+	// Extend the trail with the state samples received since the last frame
+	a.updateTrail(snap)
+	a.updateCovariance(snap, &currentPos)
+	a.updateVectors(snap, &currentPos)
 }
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/geometry"
+	"github.com/g3n/engine/graphic"
+	"github.com/g3n/engine/gui"
+	"github.com/g3n/engine/material"
+	"github.com/g3n/engine/math32"
+)
+
+// Arrow dimensions, scene units
+const (
+	arrowShaft    = 0.04 // radius
+	arrowHead     = 0.1  // radius
+	arrowHeadLen  = 0.3
+	arrowMinLen   = 1e-3
+	arrowScaleExp = 1 // slider spans 10^-exp to 10^exp times the base scale
+)
+
+// Vectors drawn on the device. Each is taken from the filter's frame
+// through sceneFrame, and base is scene units (cm) per unit of the vector.
+var sceneVectors = []struct {
+	name  string
+	unit  string
+	base  float32
+	color math32.Color
+	value func(s *filterState) math32.Vector3
+}{
+	{"Velocity", "m/s", posScale, math32.Color{R: 0.2, G: 1, B: 0.2}, func(s *filterState) math32.Vector3 {
+		return math32.Vector3{X: s.x[3], Y: s.x[4], Z: s.x[5]}
+	}},
+	{"Accel", "m/s^2", 10, math32.Color{R: 1, G: 0.3, B: 0.2}, func(s *filterState) math32.Vector3 {
+		return s.accel_f
+	}},
+	{"Optical flow", "", 1, math32.Color{R: 0.3, G: 0.5, B: 1}, func(s *filterState) math32.Vector3 {
+		return s.of_f
+	}},
+}
+
+// Arrow is a unit arrow along +Y whose length is set without stretching
+// the head
+type Arrow struct {
+	core.Node
+	shaft *graphic.Mesh
+	head  *graphic.Mesh
+}
+
+func NewArrow(shaft_g, head_g *geometry.Geometry, color *math32.Color) *Arrow {
+	ar := new(Arrow)
+	ar.Node.Init(ar)
+	mat := material.NewStandard(color)
+	ar.shaft = graphic.NewMesh(shaft_g, mat)
+	ar.head = graphic.NewMesh(head_g, mat)
+	ar.Add(ar.shaft)
+	ar.Add(ar.head)
+	return ar
+}
+
+// SetVector points the arrow from origin along v, hiding it when v is
+// too short to see
+func (ar *Arrow) SetVector(origin, v *math32.Vector3) {
+	length := v.Length()
+	if length < arrowMinLen {
+		ar.SetVisible(false)
+		return
+	}
+	ar.SetVisible(true)
+	ar.SetPositionVec(origin)
+	dir := *v
+	dir.DivideScalar(length)
+	var q math32.Quaternion
+	q.SetFromUnitVectors(&math32.Vector3{X: 0, Y: 1, Z: 0}, &dir)
+	ar.SetRotationQuat(&q)
+
+	// Short arrows shrink the head too
+	head := math32.Min(arrowHeadLen, length/2)
+	shaft := length - head
+	ar.shaft.SetScale(1, shaft, 1)
+	ar.shaft.SetPosition(0, shaft/2, 0)
+	ar.head.SetScale(head/arrowHeadLen, head/arrowHeadLen, head/arrowHeadLen)
+	ar.head.SetPosition(0, shaft+head/2, 0)
+}
+
+// setupVectors creates the device arrows, hidden until enabled
+func (a *App) setupVectors() {
+	shaft_g := geometry.NewCylinder(arrowShaft, 1, 8, 1, true, true)
+	head_g := geometry.NewCone(arrowHead, arrowHeadLen, 12, 1, true)
+	a.vec_a = make([]*Arrow, len(sceneVectors))
+	for i, sv := range sceneVectors {
+		a.vec_a[i] = NewArrow(shaft_g, head_g, &sv.color)
+		a.vec_a[i].SetVisible(false)
+		a.scene.Add(a.vec_a[i])
+	}
+}
+
+// buildVectors adds a toggle and a scale slider per device arrow
+func (a *App) buildVectors() {
+	a.vec_on = make([]bool, len(sceneVectors))
+	a.vec_scale = make([]float32, len(sceneVectors))
+	for i, sv := range sceneVectors {
+		a.vec_scale[i] = 1
+
+		vec_hb := gui.NewHBoxLayout()
+		vec_hb.SetAlignH(gui.AlignLeft)
+		vec_hb.SetAutoWidth(false)
+		vec_hb.SetSpacing(5)
+		vec_p := gui.NewPanel(a.sidebar.Width(), 16)
+		vec_p.SetLayout(vec_hb)
+		a.sidebar.Add(vec_p)
+
+		vec_cb := gui.NewCheckBox(fmt.Sprintf("%-13s", sv.name))
+		vec_cb.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+			a.vec_on[i] = vec_cb.Value()
+		})
+		vec_p.Add(vec_cb)
+		vec_sl := gui.NewHSlider(a.sidebar.Width()-vec_cb.Width()-15, vec_cb.Height())
+		vec_sl.SetValue(0.5)
+		vec_sl.SetText(a.vectorScaleText(i))
+		vec_sl.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+			// Logarithmic around the base scale
+			a.vec_scale[i] = float32(math.Pow(10, arrowScaleExp*(2*float64(vec_sl.Value())-1)))
+			vec_sl.SetText(a.vectorScaleText(i))
+		})
+		vec_p.Add(vec_sl)
+		vec_p.SetHeight(vec_sl.Height())
+	}
+}
+
+func (a *App) vectorScaleText(i int) string {
+	sv := sceneVectors[i]
+	text := fmt.Sprintf("%.3g cm", sv.base*a.vec_scale[i])
+	if sv.unit != "" {
+		text += " per " + sv.unit
+	}
+	return text
+}
+
+// updateVectors draws the enabled arrows from the device position
+func (a *App) updateVectors(snap *filterState, pos *math32.Vector3) {
+	for i, sv := range sceneVectors {
+		if !a.vec_on[i] {
+			a.vec_a[i].SetVisible(false)
+			continue
+		}
+		v := sceneFrame(sv.value(snap))
+		v.MultiplyScalar(sv.base * a.vec_scale[i])
+		a.vec_a[i].SetVector(pos, &v)
+	}
+}
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/g3n/engine/math32"
+)
+
+// Binary frames are COBS encoded and delimited by 0x00 on the wire. The
+// decoded frame is
+//
+//	[0]     message type, see binType*
+//	[1:3]   u16 field flags, see binHas*
+//	[3:7]   u32 micros
+//	[7:n-2] float32 fields present in flags, in flag bit order
+//	[n-2:n] u16 CRC-16/CCITT-FALSE of bytes [0:n-2]
+//
+// with all multi-byte values little-endian. Control frames (commands and
+// acknowledgements) carry a JSON object in place of flags, micros and fields.
+const (
+	binTypeSensor  = 0x01
+	binTypePredict = 0x02
+	binTypeUpdate  = 0x03
+	binTypeControl = 0x10
+)
+
+const (
+	binHasQuat = 1 << iota
+	binHasAccel
+	binHasOF
+	binHasState
+	binHasP
+	binHasF
+	binHasK
+	binHasYH
+)
+
+const binHeaderSize = 1 + 2 + 4
+
+// errCorruptFrame marks frames that failed COBS or CRC checks
+var errCorruptFrame = errors.New("corrupt frame")
+
+// cobsDecode reverses consistent overhead byte stuffing of one frame,
+// without its 0x00 delimiter
+func cobsDecode(enc []byte) ([]byte, error) {
+	dec := make([]byte, 0, len(enc))
+	for i := 0; i < len(enc); {
+		code := int(enc[i])
+		if code == 0 {
+			return nil, fmt.Errorf("%w: bad COBS code at %d", errCorruptFrame, i)
+		}
+		i++
+		end := i + code - 1
+		if end > len(enc) {
+			return nil, fmt.Errorf("%w: truncated COBS block", errCorruptFrame)
+		}
+		dec = append(dec, enc[i:end]...)
+		i = end
+		if code < 0xFF && i < len(enc) {
+			dec = append(dec, 0)
+		}
+	}
+	return dec, nil
+}
+
+// cobsEncode stuffs data so it contains no 0x00, the delimiter is not added
+func cobsEncode(data []byte) []byte {
+	enc := make([]byte, 1, len(data)+len(data)/254+2)
+	codePos, code := 0, byte(1)
+	for _, b := range data {
+		if b != 0 {
+			enc = append(enc, b)
+			code++
+		}
+		if b == 0 || code == 0xFF {
+			enc[codePos] = code
+			codePos, code = len(enc), 1
+			enc = append(enc, 0)
+		}
+	}
+	enc[codePos] = code
+	return enc
+}
+
+// crc16 computes CRC-16/CCITT-FALSE (poly 0x1021, init 0xFFFF)
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// unframeBinary COBS decodes a frame and strips its CRC after checking it
+func unframeBinary(frame []byte) ([]byte, error) {
+	dec, err := cobsDecode(frame)
+	if err != nil {
+		return nil, err
+	}
+	if len(dec) < 3 {
+		return nil, fmt.Errorf("%w: %d bytes is too short", errCorruptFrame, len(dec))
+	}
+	body := dec[:len(dec)-2]
+	if got, want := binary.LittleEndian.Uint16(dec[len(dec)-2:]), crc16(body); got != want {
+		return nil, fmt.Errorf("%w: CRC %04x, expected %04x", errCorruptFrame, got, want)
+	}
+	return body, nil
+}
+
+// DecodeBinary parses one COBS encoded binary frame
+func DecodeBinary(frame []byte) (*Message, error) {
+	body, err := unframeBinary(frame)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 && body[0] == binTypeControl {
+		return DecodeJSON(body[1:])
+	}
+	if len(body) < binHeaderSize {
+		return nil, &ValidationError{Field: "header", Problem: fmt.Sprintf("%d bytes, expected %d", len(body), binHeaderSize)}
+	}
+
+	kind := body[0]
+	flags := binary.LittleEndian.Uint16(body[1:3])
+	m := &Message{
+		Micros:    float64(binary.LittleEndian.Uint32(body[3:7])),
+		HasMicros: true,
+	}
+
+	// Read float fields in flag order
+	payload := body[binHeaderSize:]
+	next := func(field string, n int) ([]float32, error) {
+		if len(payload) < 4*n {
+			return nil, &ValidationError{Field: field, Problem: "truncated"}
+		}
+		values := make([]float32, n)
+		for i := range values {
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(payload[4*i:]))
+		}
+		payload = payload[4*n:]
+		return values, nil
+	}
+
+	if flags&binHasQuat != 0 {
+		v, err := next("quat", 4)
+		if err != nil {
+			return nil, err
+		}
+		m.Quat = &math32.Quaternion{X: v[0], Y: v[1], Z: v[2], W: v[3]}
+	}
+	if flags&binHasAccel != 0 {
+		v, err := next("accel", 3)
+		if err != nil {
+			return nil, err
+		}
+		m.Accel = &math32.Vector3{X: v[0], Y: v[1], Z: v[2]}
+	}
+	if flags&binHasOF != 0 {
+		v, err := next("of", 3)
+		if err != nil {
+			return nil, err
+		}
+		m.OF = &math32.Vector3{X: v[0], Y: v[1], Z: v[2]}
+	}
+	if flags&binHasState != 0 {
+		v, err := next("state", 7)
+		if err != nil {
+			return nil, err
+		}
+		m.State = &State{X: v[0], Y: v[1], Z: v[2], VX: v[3], VY: v[4], VZ: v[5], DT: v[6]}
+	}
+	if flags&binHasP != 0 {
+		if m.P, err = next("P", 6*6); err != nil {
+			return nil, err
+		}
+	}
+	if flags&binHasF != 0 {
+		if m.F, err = next("f", 6); err != nil {
+			return nil, err
+		}
+	}
+	if flags&binHasK != 0 {
+		if m.K, err = next("K", 3*6); err != nil {
+			return nil, err
+		}
+	}
+	if flags&binHasYH != 0 {
+		if m.YH, err = next("y-h", 3); err != nil {
+			return nil, err
+		}
+	}
+	if len(payload) != 0 {
+		return nil, &ValidationError{Field: "payload", Problem: fmt.Sprintf("%d unexpected trailing bytes", len(payload))}
+	}
+
+	// The type byte must agree with the fields that were sent
+	var want MessageKind
+	switch kind {
+	case binTypeSensor:
+		want = KindSensor
+	case binTypePredict:
+		want = KindPredict
+	case binTypeUpdate:
+		want = KindUpdate
+	default:
+		return nil, &ValidationError{Field: "type", Problem: fmt.Sprintf("unknown message type 0x%02x", kind)}
+	}
+	if m.Kind() != want {
+		return nil, &ValidationError{Field: "type", Problem: fmt.Sprintf("%s frame carries %s fields", want, m.Kind())}
+	}
+	return m, nil
+}
+
+// DecodeFrame decodes a frame of either framing, JSON frames start with '{'
+func DecodeFrame(frame []byte) (*Message, error) {
+	if len(frame) > 0 && frame[0] == '{' {
+		return DecodeJSON(frame)
+	}
+	return DecodeBinary(frame)
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestCOBSRoundTrip(t *testing.T) {
+	long := make([]byte, 600)
+	for i := range long {
+		long[i] = byte(i % 7) // a zero every seven bytes
+	}
+	cases := map[string][]byte{
+		"empty":     {},
+		"zero":      {0},
+		"zeros":     {0, 0, 0},
+		"no zeros":  bytes.Repeat([]byte{0x11}, 10),
+		"254 bytes": bytes.Repeat([]byte{0x22}, 254),
+		"255 bytes": bytes.Repeat([]byte{0x33}, 255),
+		"mixed":     long,
+	}
+	for name, data := range cases {
+		enc := cobsEncode(data)
+		if bytes.IndexByte(enc, 0) >= 0 {
+			t.Errorf("%s: encoding contains 0x00: % x", name, enc)
+			continue
+		}
+		dec, err := cobsDecode(enc)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(dec, data) {
+			t.Errorf("%s: decoded % x, want % x", name, dec, data)
+		}
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	// Check value of CRC-16/CCITT-FALSE
+	if got := crc16([]byte("123456789")); got != 0x29B1 {
+		t.Errorf("crc16 = %04x, want 29b1", got)
+	}
+}
+
+// binaryFrame builds a COBS encoded sensor frame with an accelerometer reading
+func binaryFrame(micros uint32) []byte {
+	body := []byte{binTypeSensor}
+	body = binary.LittleEndian.AppendUint16(body, binHasAccel)
+	body = binary.LittleEndian.AppendUint32(body, micros)
+	for _, v := range []uint32{0x3FC00000, 0xC0000000, 0x3E800000} { // 1.5, -2, 0.25
+		body = binary.LittleEndian.AppendUint32(body, v)
+	}
+	body = binary.LittleEndian.AppendUint16(body, crc16(body))
+	return cobsEncode(body)
+}
+
+func TestDecodeBinary(t *testing.T) {
+	msg, err := DecodeBinary(binaryFrame(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Micros != 1000 || msg.Accel == nil || msg.Accel.X != 1.5 || msg.Accel.Y != -2 || msg.Accel.Z != 0.25 {
+		t.Errorf("decoded %+v, accel %+v", msg, msg.Accel)
+	}
+}
+
+func TestCorruptFrames(t *testing.T) {
+	badCRC := binaryFrame(1000)
+	badCRC[5] ^= 0x40
+	badCOBS := binaryFrame(1000)
+	badCOBS[0] = 0x7F // block runs past the end
+
+	var link linkTracker
+	for _, frame := range [][]byte{badCRC, badCOBS, {0x01}} {
+		_, err := DecodeBinary(frame)
+		if !errors.Is(err, errCorruptFrame) {
+			t.Errorf("% x: error %v, want a corrupt frame", frame, err)
+		}
+		link.invalid(err)
+	}
+	_, err := DecodeJSON([]byte(`{"micros": "soon"}`))
+	if err == nil {
+		t.Fatal("malformed JSON message decoded")
+	}
+	link.invalid(err)
+
+	stats := link.snapshot()
+	if stats.Corrupt != 3 || stats.Invalid != 1 {
+		t.Errorf("corrupt %d, invalid %d, want 3 and 1", stats.Corrupt, stats.Invalid)
+	}
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// sessionRawFile holds every received frame verbatim, one JSON record per
+// line, so a session can be decoded again with newer parsers
+const sessionRawFile = "raw.jsonl"
+
+// rawRecord is one captured frame. Delimiters and length prefixes are
+// stripped, the framing follows from the format. Text frames are stored
+// as-is in Raw, anything that is not valid UTF-8 goes base64 in B64.
+type rawRecord struct {
+	THost  int64  `json:"t_host"` // host receive time, unix nanoseconds
+	Format string `json:"format"`
+	Raw    string `json:"raw,omitempty"`
+	B64    string `json:"b64,omitempty"`
+}
+
+func newRawRecord(t time.Time, frame []byte, format WireFormat) rawRecord {
+	rec := rawRecord{THost: t.UnixNano(), Format: format.String()}
+	if utf8.Valid(frame) {
+		rec.Raw = string(frame)
+	} else {
+		rec.B64 = base64.StdEncoding.EncodeToString(frame)
+	}
+	return rec
+}
+
+// Bytes returns the frame as received
+func (r *rawRecord) Bytes() ([]byte, error) {
+	if r.B64 != "" {
+		return base64.StdEncoding.DecodeString(r.B64)
+	}
+	return []byte(r.Raw), nil
+}
+
+// rawCapture writes captured frames from its own goroutine, like
+// csvLogger, so a slow disk never holds up the source readers. Records
+// are dropped, and counted, when the queue is full.
+type rawCapture struct {
+	records chan rawRecord
+	done    chan struct{}
+	dropped atomic.Int64
+
+	file *os.File
+	enc  *json.Encoder
+}
+
+// openCapture creates the raw capture of a session
+func openCapture(dir string) *rawCapture {
+	rawFileName := filepath.Join(logRoot, dir, sessionRawFile)
+	f, err := os.Create(rawFileName)
+	if err != nil {
+		fmt.Println("Error opening raw capture: " + rawFileName + " with error: " + err.Error())
+		return nil
+	}
+	rc := &rawCapture{
+		records: make(chan rawRecord, logQueueSize),
+		done:    make(chan struct{}),
+		file:    f,
+		enc:     json.NewEncoder(f),
+	}
+	rc.enc.SetEscapeHTML(false)
+	go rc.run()
+	return rc
+}
+
+// write queues a record without blocking, reporting false if it was
+// dropped. It must not be called after close.
+func (rc *rawCapture) write(rec rawRecord) bool {
+	select {
+	case rc.records <- rec:
+		return true
+	default:
+		rc.dropped.Add(1)
+		return false
+	}
+}
+
+// stop ends the queue, like csvLogger.stop
+func (rc *rawCapture) stop() {
+	close(rc.records)
+}
+
+// wait blocks until the file is closed after stop
+func (rc *rawCapture) wait() {
+	<-rc.done
+}
+
+func (rc *rawCapture) run() {
+	defer close(rc.done)
+	for rec := range rc.records {
+		// One write per record, a crash loses at most the last line
+		if err := rc.enc.Encode(rec); err != nil {
+			fmt.Println("Error writing raw capture:", err)
+		}
+	}
+	if err := rc.file.Sync(); err != nil {
+		fmt.Println("Error syncing raw capture:", err)
+	}
+	if err := rc.file.Close(); err != nil {
+		fmt.Println("Error closing raw capture:", err)
+	}
+	if d := rc.dropped.Load(); d > 0 {
+		fmt.Printf("Raw capture closed, %d frames dropped in total\n", d)
+	}
+}
+
+// WriteRaw captures a frame as it came off the source, before decoding
+func (c *Connector) WriteRaw(t time.Time, frame []byte, format WireFormat) {
+	rec := newRawRecord(t, frame, format)
+
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+
+	if c.capture == nil {
+		return
+	}
+	if c.capture.write(rec) {
+		c.session.Frames++
+	}
+}
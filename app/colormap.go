@@ -0,0 +1,48 @@
+package app
+
+import (
+	"github.com/g3n/engine/math32"
+)
+
+// Colormap maps [0, 1] onto evenly spaced colour stops
+type Colormap struct {
+	name  string
+	stops []math32.Color
+}
+
+func newColormap(name string, hex ...uint) Colormap {
+	m := Colormap{name: name, stops: make([]math32.Color, len(hex))}
+	for i, h := range hex {
+		m.stops[i].SetHex(h)
+	}
+	return m
+}
+
+// Colormaps selectable for the trail, in dropdown order
+var colormaps = []Colormap{
+	newColormap("Viridis",
+		0x440154, 0x46327e, 0x3b528b, 0x2c728e, 0x21918c,
+		0x28ae80, 0x5ec962, 0xaddc30, 0xfde725),
+	newColormap("Turbo",
+		0x30123b, 0x4145ab, 0x4675ed, 0x39a2fc, 0x1bcfd4,
+		0x24eca6, 0x61fc6c, 0xa4fc3b, 0xd1e834, 0xf3c63a,
+		0xfe9b2d, 0xf36315, 0xd93806, 0xb11901, 0x7a0403),
+	newColormap("Diverging",
+		0x3b4cc0, 0x6f92f3, 0xaac7fd, 0xdddddd, 0xf7b89c, 0xe7745b, 0xb40426),
+}
+
+// At returns the colour at v, clamped to [0, 1]
+func (m *Colormap) At(v float32) math32.Color {
+	if v != v || v <= 0 { // NaN too
+		return m.stops[0]
+	}
+	last := len(m.stops) - 1
+	if v >= 1 {
+		return m.stops[last]
+	}
+	f := v * float32(last)
+	i := int(f)
+	c := m.stops[i]
+	c.Lerp(&m.stops[i+1], f-float32(i))
+	return c
+}
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How long to wait for the device to acknowledge a command
+const commandTimeout = 2 * time.Second
+
+// Commands understood by the LocationCore firmware
+const (
+	cmdReset      = "reset"       // reset the filter state
+	cmdZero       = "zero"        // zero the position estimate
+	cmdSetRates   = "set_rates"   // args predict_hz, update_hz
+	cmdSetNoise   = "set_noise"   // args Q (6), R (3)
+	cmdSetP0      = "set_p0"      // args P0 (6)
+	cmdDumpParams = "dump_params" // reply carries params
+)
+
+var (
+	errNotWritable  = errors.New("source does not support commands")
+	errNotConnected = errors.New("not connected")
+)
+
+// WritableSource is a Source that can send frames back to the device.
+// Framing reports the framing of the stream, as detected for Auto, and
+// WriteFrame adds its delimiter like ReadFrame removes it.
+type WritableSource interface {
+	Source
+	Framing() Framing
+	WriteFrame(frame []byte, framing Framing) error
+}
+
+// Ack is the device's reply to a command, matched on the request ID
+type Ack struct {
+	ID     uint32
+	OK     bool
+	Error  string
+	Params *FilterParams // current parameters, sent with dump_params replies
+}
+
+// FilterParams are the tunable filter parameters reported by the device
+type FilterParams struct {
+	Q         []float32 `json:"Q"`  // process noise per state
+	R         []float32 `json:"R"`  // measurement noise per optical-flow axis
+	P0        []float32 `json:"P0"` // initial covariance diagonal
+	PredictHz float32   `json:"predict_hz"`
+	UpdateHz  float32   `json:"update_hz"`
+}
+
+type pendingCommand struct {
+	name  string
+	args  map[string]interface{}
+	timer *time.Timer
+}
+
+// commandChannel tracks commands awaiting acknowledgement
+type commandChannel struct {
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]*pendingCommand
+	params  *FilterParams
+}
+
+// encodeCommand encodes a JSON command for the framing of the stream,
+// COBS streams carry it in a binary control frame with CRC
+func encodeCommand(payload []byte, framing Framing) []byte {
+	if framing == FramingCOBS {
+		body := append([]byte{binTypeControl}, payload...)
+		body = binary.LittleEndian.AppendUint16(body, crc16(body))
+		return cobsEncode(body)
+	}
+	return payload
+}
+
+// SendCommand writes a command to the active source and returns its
+// request ID, the acknowledgement is reported to the serial monitor.
+// Commands are JSON objects {"cmd": name, "id": id, args...}.
+func (c *Connector) SendCommand(name string, args map[string]interface{}) (uint32, error) {
+	c.statusMu.Lock()
+	src, ok := c.active.(WritableSource)
+	c.statusMu.Unlock()
+	if !ok {
+		return 0, errNotWritable
+	}
+
+	c.cmd.mu.Lock()
+	if c.cmd.pending == nil {
+		c.cmd.pending = make(map[uint32]*pendingCommand)
+	}
+	c.cmd.nextID++
+	id := c.cmd.nextID
+	c.cmd.mu.Unlock()
+
+	request := map[string]interface{}{"cmd": name, "id": id}
+	for k, v := range args {
+		request[k] = v
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return 0, err
+	}
+
+	c.cmd.mu.Lock()
+	c.cmd.pending[id] = &pendingCommand{
+		name: name,
+		args: args,
+		timer: time.AfterFunc(commandTimeout, func() {
+			c.expireCommand(id)
+		}),
+	}
+	c.cmd.mu.Unlock()
+
+	// Taken once, detection may lock in while the command is encoded
+	framing := src.Framing()
+	if err := src.WriteFrame(encodeCommand(payload, framing), framing); err != nil {
+		c.expireCommand(id)
+		return 0, err
+	}
+	fmt.Printf("Sent command %s #%d\n", name, id)
+	c.WriteEvent(fmt.Sprintf("command %s", payload))
+	return id, nil
+}
+
+func (c *Connector) handleAck(ack *Ack) {
+	c.cmd.mu.Lock()
+	cmd, ok := c.cmd.pending[ack.ID]
+	if ok {
+		cmd.timer.Stop()
+		delete(c.cmd.pending, ack.ID)
+	}
+	if ack.Params != nil {
+		c.cmd.params = ack.Params
+	}
+	c.cmd.mu.Unlock()
+
+	if !ok {
+		fmt.Printf("Unexpected acknowledgement #%d\n", ack.ID)
+		return
+	}
+	// Loss counting follows the predict rate
+	if ack.Params != nil {
+		c.link.setRate(ack.Params.PredictHz)
+	} else if hz, ok := cmd.args["predict_hz"].(float32); ok && ack.OK && cmd.name == cmdSetRates {
+		c.link.setRate(hz)
+	}
+	c.WriteEvent(fmt.Sprintf("ack %s #%d ok=%t %s", cmd.name, ack.ID, ack.OK, ack.Error))
+	if ack.OK {
+		c.notices.push(fmt.Sprintf("Device acknowledged %s #%d", cmd.name, ack.ID))
+	} else {
+		c.notices.push(fmt.Sprintf("Device rejected %s #%d: %s", cmd.name, ack.ID, ack.Error))
+	}
+}
+
+func (c *Connector) expireCommand(id uint32) {
+	c.cmd.mu.Lock()
+	cmd, ok := c.cmd.pending[id]
+	if ok {
+		cmd.timer.Stop()
+		delete(c.cmd.pending, id)
+	}
+	c.cmd.mu.Unlock()
+
+	if ok {
+		c.notices.push(fmt.Sprintf("No acknowledgement for %s #%d", cmd.name, id))
+	}
+}
+
+// DeviceParams returns the last parameters reported by the device, or nil
+func (c *Connector) DeviceParams() *FilterParams {
+	c.cmd.mu.Lock()
+	defer c.cmd.mu.Unlock()
+	return c.cmd.params
+}
+
+func (c *Connector) ResetFilter() (uint32, error) {
+	return c.SendCommand(cmdReset, nil)
+}
+
+func (c *Connector) ZeroPosition() (uint32, error) {
+	return c.SendCommand(cmdZero, nil)
+}
+
+func (c *Connector) SetRates(predictHz, updateHz float32) (uint32, error) {
+	return c.SendCommand(cmdSetRates, map[string]interface{}{"predict_hz": predictHz, "update_hz": updateHz})
+}
+
+func (c *Connector) SetNoise(Q, R []float32) (uint32, error) {
+	return c.SendCommand(cmdSetNoise, map[string]interface{}{"Q": Q, "R": R})
+}
+
+func (c *Connector) SetInitialCovariance(P0 []float32) (uint32, error) {
+	return c.SendCommand(cmdSetP0, map[string]interface{}{"P0": P0})
+}
+
+func (c *Connector) RequestParams() (uint32, error) {
+	return c.SendCommand(cmdDumpParams, nil)
+}
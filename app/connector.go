@@ -1,19 +1,16 @@
 package app
 
 import (
-	"bufio"
-	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
-	"os"
-	"strings"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/g3n/engine/gui"
 	"github.com/g3n/engine/math32"
 	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
 )
 
 func rotateOnAxis(xx, yy, zz int, a float32) *math32.Quaternion {
@@ -29,159 +26,247 @@ func rotateOnAxis(xx, yy, zz int, a float32) *math32.Quaternion {
 }
 
 type Connector struct {
-	// Serial port connection
+	// Data source connection
+	link        linkTracker
+	statusMu    sync.Mutex
+	active      Source
+	state       ConnState
+	stateDetail string
+	cmd         commandChannel
 
 	// Link back to display
-	srm *gui.ItemScroller
-	rso bool
-
-	// Kalman State
-	x     math32.ArrayF32
-	x_pos math32.Vector3
-	P     math32.ArrayF32
-	f     math32.ArrayF32
-	K     math32.ArrayF32
-	yh    math32.ArrayF32
-
-	predict_cpu float32
-	update_cpu  float32
-
-	lin_accel math32.Vector3
-	orin      math32.Quaternion
-	orin_e    math32.Vector3
-	of_d      math32.Vector3
-
-	x_pos_a     []math32.Vector3
-	lin_accel_a []math32.Vector3
-	orin_e_a    []math32.Vector3
-	of_d_a      []math32.Vector3
+	notices noticeQueue
+
+	// Filter state, owned by the ingest goroutine
+	*filterState
+	clock    deviceClock
+	ingest   chan rawFrame
+	dirty    bool
+	snapshot atomic.Pointer[filterState]
+	empty    *filterState
 
 	historySize      int
 	posS             int
 	updateGraphsFunc func()
 
-	logFile   *os.File
-	logWriter *csv.Writer
+	// logMu is taken per frame and only guards swapping these, sessMu
+	// orders session changes and the index file
+	logMu   sync.Mutex
+	logger  *csvLogger
+	capture *rawCapture
+	session *SessionInfo // being recorded
+	sessMu  sync.Mutex
 }
 
 var (
 	qRobotProjection = rotateOnAxis(1, 0, 0, math32.Pi/2).Multiply(rotateOnAxis(0, 0, 1, math32.Pi/2))
 )
 
-func (c *Connector) setScroller(scroller *gui.ItemScroller) {
-	c.srm = scroller
+// sceneFrame maps a vector from the filter's frame into the scene, flip Y
+// and Z then rotate by qRobotProjection. Positions are also scaled by posS.
+func sceneFrame(v math32.Vector3) math32.Vector3 {
+	v.Y = -v.Y
+	v.Z = -v.Z
+	v.ApplyQuaternion(qRobotProjection)
+	return v
+}
+
+// Notices returns and clears the serial monitor lines queued since the
+// last call
+func (c *Connector) Notices() []string {
+	return c.notices.drain()
 }
 
 func (c *Connector) setUpdateGraphsFunc(f func(), hist int, pS int) {
 	c.historySize = hist
 	c.posS = pS
-	c.lin_accel_a = make([]math32.Vector3, c.historySize)
-	c.orin_e_a = make([]math32.Vector3, c.historySize)
-	c.of_d_a = make([]math32.Vector3, c.historySize)
-	c.x_pos_a = make([]math32.Vector3, c.historySize)
-
-	c.x = make(math32.ArrayF32, 6)
-	c.P = make(math32.ArrayF32, 6*6)
-	c.f = make(math32.ArrayF32, 6)
-	c.K = make(math32.ArrayF32, 3*6)
-	c.yh = make(math32.ArrayF32, 3)
+	c.filterState = newFilterState(c.historySize)
+	c.empty = newFilterState(c.historySize)
 
 	c.updateGraphsFunc = f
+
+	c.ingest = make(chan rawFrame, ingestQueueSize)
+	go c.ingestRoutine()
 }
 
-func (c *Connector) GetPorts() []string {
-	ports, err := serial.GetPortsList()
+// GetPorts lists the serial ports currently present, possibly none
+func (c *Connector) GetPorts() []PortInfo {
+	var ports []PortInfo
+	details, err := enumerator.GetDetailedPortsList()
+	if err == nil {
+		for _, d := range details {
+			ports = append(ports, portInfoFromDetails(d))
+		}
+		return ports
+	}
+
+	// Detailed enumeration is not available on every OS
+	names, err := serial.GetPortsList()
 	if err != nil {
-		panic(err)
+		fmt.Println("Error listing serial ports:", err)
+		return nil
 	}
-	if len(ports) == 0 {
-		// fmt.Println("No serial ports found!")
-		time.Sleep(1 * time.Second)
-		return c.GetPorts()
+	for _, name := range names {
+		ports = append(ports, PortInfo{Name: name})
 	}
 	return ports
 }
 
-func (c *Connector) ConnectPort(portname string) {
-	fmt.Printf("Connecting to port %s\n", portname)
+func (c *Connector) ConnectPort(portname string, config SerialConfig, format WireFormat) {
+	c.Connect(NewSerialSource(portname, config, format))
+}
 
-	mode := &serial.Mode{
-		BaudRate: 115200,
-	}
-	port, err := serial.Open(portname, mode)
-	if err != nil {
-		panic(err)
-	}
+// Connect makes src the single active source, closing any previous one
+func (c *Connector) Connect(src Source) {
+	c.Disconnect()
 
-	c.srm.Add(gui.NewImageLabel("Connected to port: " + portname))
-
-	// go c.recvRoutine(port)
-	var buffer strings.Builder
-	var mu sync.Mutex
-	go func() {
-		reader := bufio.NewReader(port)
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				panic(err)
-			}
-			mu.Lock()
-			buffer.WriteString(line)
-			if strings.Contains(line, "\n") {
-				data := buffer.String()
-				c.portRecvCb(data)
-				buffer.Reset()
-			}
-			mu.Unlock()
-		}
-	}()
+	fmt.Printf("Connecting to %s\n", src.Describe())
+	c.notices.push("Connecting to " + src.Describe() + "...")
+	c.statusMu.Lock()
+	c.active = src
+	c.state = StateConnecting
+	c.stateDetail = src.Describe()
+	c.statusMu.Unlock()
+	c.link.reset()
 
+	go c.readRoutine(src)
 }
 
-func (c *Connector) StartNewLog() {
-	if c.logFile != nil {
-		c.logFile.Close()
-	}
-	if c.logWriter != nil {
-		c.logWriter.Flush()
-		c.logWriter = nil
+// Disconnect closes the active source, keeping the scene and history
+func (c *Connector) Disconnect() {
+	c.statusMu.Lock()
+	src := c.active
+	c.active = nil
+	if src != nil {
+		c.state = StateIdle
+		c.stateDetail = ""
 	}
-	// Generate log filename as log_DDMMYY_HHMMSS.csv in folder log
-	t := time.Now()
-	logFileName := fmt.Sprintf("log_%02d%02d%02d_%02d%02d%02d.csv", t.Day(), t.Month(), t.Year()%100, t.Hour(), t.Minute(), t.Second())
-	if _, err := os.Stat("log"); os.IsNotExist(err) {
-		os.Mkdir("log", os.ModePerm)
+	c.statusMu.Unlock()
+
+	if src != nil {
+		fmt.Printf("Disconnecting from %s\n", src.Describe())
+		c.notices.push("Disconnected from " + src.Describe())
+		src.Close()
 	}
-	logFileName = "log/" + logFileName
-	fmt.Println("Log file: " + logFileName)
-	// Clear all files in log folder
-	files, err := os.ReadDir("log")
-	if err != nil {
-		panic("Error reading log folder: " + err.Error())
+}
+
+func (c *Connector) readRoutine(src Source) {
+	// Opening may block, e.g. a TCP server waiting for the device
+	if err := src.Open(); err != nil {
+		if !c.isActive(src) {
+			return
+		}
+		fmt.Printf("Error connecting to %s: %v\n", src.Describe(), err)
+		c.notices.push("Failed to connect to " + src.Describe() + ": " + err.Error())
+		c.release(src, StateError, err.Error())
+		return
 	}
-	for _, file := range files {
-		if file.Name() != logFileName {
-			err := os.Remove("log/" + file.Name())
-			if err != nil {
-				panic("Error removing file: " + file.Name() + " with error: " + err.Error())
+	defer src.Close()
+
+	c.notices.push("Connected to " + src.Describe())
+	c.setState(src, StateConnected, src.Describe())
+
+	for {
+		frame, err := src.ReadFrame()
+		var rewind *replayRewind
+		if errors.As(err, &rewind) {
+			if !c.isActive(src) {
+				return
 			}
+			c.ingest <- rawFrame{reset: true, state: &rewind.state}
+			continue
 		}
+		if err != nil {
+			// Closed on purpose by Disconnect or a newer Connect
+			if !c.isActive(src) {
+				return
+			}
+			rs, ok := src.(ReconnectingSource)
+			if !ok {
+				if err == io.EOF {
+					fmt.Printf("End of stream from %s\n", src.Describe())
+					c.release(src, StateDisconnected, "stream ended")
+				} else {
+					fmt.Printf("Error reading from %s: %v\n", src.Describe(), err)
+					c.release(src, StateError, err.Error())
+				}
+				return
+			}
+			// Keep the scene and history, the device is expected back
+			fmt.Printf("Lost %s: %v\n", src.Describe(), err)
+			c.notices.push("Disconnected from " + src.Describe() + ", reconnecting...")
+			c.setState(src, StateDisconnected, "waiting for device...")
+			c.WriteEvent("disconnected")
+			if err := rs.Reconnect(); err != nil {
+				fmt.Printf("Stopped reading from %s: %v\n", src.Describe(), err)
+				return
+			}
+			c.notices.push("Reconnected to " + src.Describe())
+			c.setState(src, StateConnected, src.Describe())
+			c.WriteEvent("reconnected")
+			continue
+		}
+		if !c.isActive(src) {
+			return
+		}
+		// Replayed frames are already recorded
+		_, replayed := src.(*ReplaySource)
+		if !replayed {
+			c.WriteRaw(time.Now(), frame, src.Format())
+		}
+		c.ingest <- rawFrame{data: frame, format: src.Format(), replayed: replayed}
 	}
-	// Create log file
-	c.logFile, err = os.Create(logFileName)
-	if err != nil {
-		panic("Error opening file: " + logFileName + " with error: " + err.Error())
+}
+
+func (c *Connector) isActive(src Source) bool {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.active == src
+}
+
+// setState updates the lifecycle state if src is still the active source
+func (c *Connector) setState(src Source, state ConnState, detail string) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	if c.active != src {
+		return
 	}
+	c.state = state
+	c.stateDetail = detail
+}
 
-	// Create writer
-	c.logWriter = csv.NewWriter(c.logFile)
+// release drops src as the active source after it stopped on its own
+func (c *Connector) release(src Source, state ConnState, detail string) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	if c.active != src {
+		return
+	}
+	c.active = nil
+	c.state = state
+	c.stateDetail = detail
+}
 
-	// write header
-	c.WriteHeader()
+// Status returns the lifecycle state and a short description of it
+func (c *Connector) Status() (ConnState, string) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.state, c.stateDetail
 }
 
-func (c *Connector) WriteHeader() {
-	// Prepare header
+// HasActive reports whether a source is connected or trying to be
+func (c *Connector) HasActive() bool {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.active != nil
+}
+
+func (c *Connector) LinkStats() LinkStats {
+	return c.link.snapshot()
+}
+
+// logHeader returns the CSV column names, one row per message or event
+func logHeader() []string {
 	header := []string{
 		"t",
 		"predict_cpu",
@@ -206,142 +291,106 @@ func (c *Connector) WriteHeader() {
 	for i := range 6 * 6 {
 		header = append(header, fmt.Sprintf("P_%d", i))
 	}
-	// Write header
-	if err := c.logWriter.Write(header); err != nil {
-		panic("Error writing header to log file: " + err.Error())
-	}
-	// Flush immediately
-	c.logWriter.Flush()
-	if err := c.logFile.Sync(); err != nil {
-		panic("Error syncing logfile: " + err.Error())
-	}
+	header = append(header, "event")
+	return header
 }
 
-func (c *Connector) WriteLog(data map[string]interface{}) {
+// WriteHeader queues the column names, the caller holds logMu
+func (c *Connector) WriteHeader() {
+	c.logger.write(logHeader())
+}
+
+func (c *Connector) WriteLog(msg *Message) {
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+
 	// Write header
-	if c.logWriter == nil {
+	if c.logger == nil {
 		// c.StartNewLog()
 		return
 	}
 
-	// Extract data
-	var micros float64
-	var quat_x, quat_y, quat_z, quat_w, accel_x, accel_y, accel_z, of_x, of_y, of_z float32
-	var x_x, x_y, x_z, x_vx, x_vy, x_vz, dt float32
-	var predict_cpu, update_cpu float32
-	P := make([]float32, 6*6)
-	if data["sensor_input"] != nil {
-		sensor_input := data["sensor_input"].(map[string]interface{})
-		if sensor_input["quat"] != nil {
-			quat := sensor_input["quat"].(map[string]interface{})
-			quat_x = float32(quat["x"].(float64))
-			quat_y = float32(quat["y"].(float64))
-			quat_z = float32(quat["z"].(float64))
-			quat_w = float32(quat["w"].(float64))
-		}
-		if sensor_input["accel"] != nil {
-			accel := sensor_input["accel"].(map[string]interface{})
-			accel_x = float32(accel["x"].(float64))
-			accel_y = float32(accel["y"].(float64))
-			accel_z = float32(accel["z"].(float64))
-		} else {
-			accel_x = -math.MaxFloat32
-			accel_y = -math.MaxFloat32
-			accel_z = -math.MaxFloat32
-		}
-		if sensor_input["of"] != nil {
-			of := sensor_input["of"].(map[string]interface{})
-			of_x = float32(of["x"].(float64))
-			of_y = float32(of["y"].(float64))
-			of_z = float32(of["z"].(float64))
-		} else {
-			of_x = -math.MaxFloat32
-			of_y = -math.MaxFloat32
-			of_z = -math.MaxFloat32
-		}
-	}
-	if data["state"] != nil {
-		state := data["state"].(map[string]interface{})
-		x_x = float32(state["x"].(float64))
-		x_y = float32(state["y"].(float64))
-		x_z = float32(state["z"].(float64))
-		x_vx = float32(state["vx"].(float64))
-		x_vy = float32(state["vy"].(float64))
-		x_vz = float32(state["vz"].(float64))
-		dt = float32(state["dt"].(float64))
-		micros = data["micros"].(float64) / 1e6
-
-		if data["f"] != nil {
-			// We are in predict step
-			predict_cpu = dt / (1.0 / 50) // 50 Hz predict
-			// }
-		} else if data["y-h"] != nil {
-			// We are in update step
-			update_cpu = dt / (1.0 / 10) // 10 Hz update
-		}
-	}
-	if data["P"] != nil {
-		for i := 0; i < 6*6; i++ {
-			P[i] = float32(data["P"].([]interface{})[i].(float64))
-		}
-	} else {
-		for i := 0; i < 6*6; i++ {
-			P[i] = -math.MaxFloat32
-		}
-	}
-
 	// Write data
 	var row []string
-	row = append(row, fmt.Sprintf("%3.7f", micros))
-	if data["f"] != nil {
-		row = append(row, fmt.Sprintf("%3.7f", predict_cpu), "")
-	} else {
-		row = append(row, "", fmt.Sprintf("%3.7f", update_cpu))
+	row = append(row, fmt.Sprintf("%3.7f", msg.Micros/1e6))
+	var dt float32
+	if msg.State != nil {
+		dt = msg.State.DT
 	}
-	row = append(row,
-		fmt.Sprintf("%3.7f", quat_x),
-		fmt.Sprintf("%3.7f", quat_y),
-		fmt.Sprintf("%3.7f", quat_z),
-		fmt.Sprintf("%3.7f", quat_w))
-	if accel_x != -math.MaxFloat32 {
+	switch msg.Kind() {
+	case KindPredict:
+		row = append(row, fmt.Sprintf("%3.7f", dt/(1.0/50)), "") // 50 Hz predict
+	case KindUpdate:
+		row = append(row, "", fmt.Sprintf("%3.7f", dt/(1.0/10))) // 10 Hz update
+	default:
+		row = append(row, "", fmt.Sprintf("%3.7f", 0.0))
+	}
+	if msg.Quat != nil {
 		row = append(row,
-			fmt.Sprintf("%3.7f", accel_x),
-			fmt.Sprintf("%3.7f", accel_y),
-			fmt.Sprintf("%3.7f", accel_z))
+			fmt.Sprintf("%3.7f", msg.Quat.X),
+			fmt.Sprintf("%3.7f", msg.Quat.Y),
+			fmt.Sprintf("%3.7f", msg.Quat.Z),
+			fmt.Sprintf("%3.7f", msg.Quat.W))
 	} else {
-		row = append(row, "", "", "")
+		row = append(row, "", "", "", "")
 	}
-	if of_x != -math.MaxFloat32 {
+	row = appendVec(row, msg.Accel)
+	row = appendVec(row, msg.OF)
+	if msg.State != nil {
 		row = append(row,
-			fmt.Sprintf("%3.7f", of_x),
-			fmt.Sprintf("%3.7f", of_y),
-			fmt.Sprintf("%3.7f", of_z))
+			fmt.Sprintf("%3.7f", msg.State.X),
+			fmt.Sprintf("%3.7f", msg.State.Y),
+			fmt.Sprintf("%3.7f", msg.State.Z),
+			fmt.Sprintf("%3.7f", msg.State.VX),
+			fmt.Sprintf("%3.7f", msg.State.VY),
+			fmt.Sprintf("%3.7f", msg.State.VZ),
+			fmt.Sprintf("%3.7f", msg.State.DT))
 	} else {
-		row = append(row, "", "", "")
+		row = append(row, "", "", "", "", "", "", "")
 	}
-	row = append(row,
-		fmt.Sprintf("%3.7f", x_x),
-		fmt.Sprintf("%3.7f", x_y),
-		fmt.Sprintf("%3.7f", x_z),
-		fmt.Sprintf("%3.7f", x_vx),
-		fmt.Sprintf("%3.7f", x_vy),
-		fmt.Sprintf("%3.7f", x_vz),
-		fmt.Sprintf("%3.7f", dt))
 	for i := range 6 * 6 {
-		if P[i] != -math.MaxFloat32 {
-			row = append(row, fmt.Sprintf("%3.7f", P[i]))
+		if msg.P != nil {
+			row = append(row, fmt.Sprintf("%3.7f", msg.P[i]))
 		} else {
 			row = append(row, "")
 		}
 	}
+	row = append(row, "")
 
-	if err := c.logWriter.Write(row); err != nil {
-		fmt.Println("Error writing to log file:", err)
+	// Flushed by the logger goroutine
+	if c.logger.write(row) {
+		c.session.Messages++
 	}
-	// Flush immediately
-	c.logWriter.Flush()
-	if err := c.logFile.Sync(); err != nil {
-		panic("Error syncing logfile: " + err.Error())
+}
+
+// appendVec appends three log columns, left empty when the vector is absent
+func appendVec(row []string, v *math32.Vector3) []string {
+	if v == nil {
+		return append(row, "", "", "")
+	}
+	return append(row,
+		fmt.Sprintf("%3.7f", v.X),
+		fmt.Sprintf("%3.7f", v.Y),
+		fmt.Sprintf("%3.7f", v.Z))
+}
+
+// WriteEvent records a connection or tuning event as its own log row,
+// timestamped with the last device time seen
+func (c *Connector) WriteEvent(event string) {
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+
+	if c.logger == nil {
+		return
+	}
+
+	// Leave every data column empty
+	row := make([]string, len(logHeader()))
+	row[0] = fmt.Sprintf("%3.7f", c.link.last()/1e6)
+	row[len(row)-1] = event
+
+	if c.logger.write(row) {
+		c.session.Events++
 	}
 }
 
@@ -350,7 +399,7 @@ var (
 	count = 0
 )
 
-func (c *Connector) portRecvCb(recv string) {
+func (c *Connector) portRecvCb(recv []byte, format WireFormat, record bool) {
 	if len(recv) == 0 {
 		return
 	}
@@ -368,6 +417,7 @@ func (c *Connector) portRecvCb(recv string) {
 		elapsed := time.Since(start).Seconds()
 		if elapsed >= 1 {
 			fmt.Printf("Function called %d times per second\n", count)
+			fmt.Printf("Link: %s\n", c.link.snapshot())
 			count = 0
 			start = time.Now()
 		}
@@ -386,78 +436,52 @@ func (c *Connector) portRecvCb(recv string) {
 
 	// fmt.Println("Received: " + recv)
 
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(recv), &data); err != nil {
-		fmt.Println("Error parsing JSON:", err)
+	msg, err := format.Decode(recv)
+	if err != nil {
+		fmt.Println("Error decoding message:", err)
+		c.link.invalid(err)
 		return
 	} else {
 		// fmt.Println("Parsed JSON Data:", data)
 
-		// todo: add logging routine
-		go c.WriteLog(data)
+		if msg.Ack != nil {
+			c.handleAck(msg.Ack)
+			return
+		}
 
-		go func() {
-			// wait for flag to release
-			for c.rso {
-				time.Sleep(1 * time.Millisecond)
+		// Drop stale messages, datagram transports do not preserve order
+		if msg.HasMicros {
+			msg.Micros = c.clock.unwrap(msg.Micros)
+			if !c.link.track(msg.Micros) {
+				return
 			}
-			c.rso = true // lock flag
-
-			/*
-				if data["motion"] != nil {
-					c.of_d = math32.Vector3{
-						X: c.of_d.X + float32(data["delta_x"].(float64)),
-						Y: c.of_d.Y + float32(data["delta_y"].(float64)),
-						Z: 0,
-					}
+			c.t = msg.Micros / 1e6
+		}
 
-					//todo: map thru orien quaternion into 3D space
-					c.of_d.ApplyQuaternion(&c.orin)
+		// todo: add logging routine
+		if record {
+			c.WriteLog(msg)
+		}
 
-				} else {
-					if data["quat9"] != nil {
-						quat9 := data["quat9"].(map[string]interface{})
-						c.orin = math32.Quaternion{
-							X: float32(quat9["y"].(float64)),
-							Y: float32(quat9["x"].(float64)),
-							Z: -float32(quat9["z"].(float64)),
-							W: float32(quat9["w"].(float64)),
-						}
-						// Flip Z, Rotate by 90 on X axis, Rotate by 90 on Z axis
-						c.orin = *c.orin.MultiplyQuaternions(qRobotProjection, &c.orin)
-						// Convert to Euler
-						c.orin_e.SetFromQuaternion(&c.orin)
-						c.orin_e.MultiplyScalar(180 / math32.Pi)
-						c.orin_e.X += 90 //? not sure why this is needed
-					}
-					if data["linear_accel"] != nil {
-						lin_accel := data["linear_accel"].(map[string]interface{})
-						c.lin_accel = math32.Vector3{
-							X: float32(lin_accel["x"].(float64)),
-							Y: float32(lin_accel["y"].(float64)),
-							Z: float32(lin_accel["z"].(float64)),
-						}
-						c.lin_accel.ApplyQuaternion(qRobotProjection)
-						//! needs to be converted to global frame
-						//c.lin_accel.ApplyQuaternion(&c.orin)
-						// c.of_d.Add(&c.lin_accel) // dead reckoning
-						// Integrate acceleration to update position
-							// dt := float32(1) / 10 // assuming a fixed time step, you may need to adjust this
-							// c.lin_accel_v.Add(c.lin_accel.MultiplyScalar(dt))
-							// c.of_d.Add(c.lin_accel_v.MultiplyScalar(dt).MultiplyScalar(10))
-					}
+		/*
+			if data["motion"] != nil {
+				c.of_d = math32.Vector3{
+					X: c.of_d.X + float32(data["delta_x"].(float64)),
+					Y: c.of_d.Y + float32(data["delta_y"].(float64)),
+					Z: 0,
 				}
-			*/
 
-			if data["sensor_input"] != nil {
-				sensor_input := data["sensor_input"].(map[string]interface{})
-				if sensor_input["quat"] != nil {
-					quat := sensor_input["quat"].(map[string]interface{})
+				//todo: map thru orien quaternion into 3D space
+				c.of_d.ApplyQuaternion(&c.orin)
+
+			} else {
+				if data["quat9"] != nil {
+					quat9 := data["quat9"].(map[string]interface{})
 					c.orin = math32.Quaternion{
-						X: float32(quat["x"].(float64)),
-						Y: float32(quat["y"].(float64)),
-						Z: float32(quat["z"].(float64)),
-						W: float32(quat["w"].(float64)),
+						X: float32(quat9["y"].(float64)),
+						Y: float32(quat9["x"].(float64)),
+						Z: -float32(quat9["z"].(float64)),
+						W: float32(quat9["w"].(float64)),
 					}
 					// Flip Z, Rotate by 90 on X axis, Rotate by 90 on Z axis
 					c.orin = *c.orin.MultiplyQuaternions(qRobotProjection, &c.orin)
@@ -466,142 +490,145 @@ func (c *Connector) portRecvCb(recv string) {
 					c.orin_e.MultiplyScalar(180 / math32.Pi)
 					c.orin_e.X += 90 //? not sure why this is needed
 				}
-				if sensor_input["accel"] != nil {
-					accel := sensor_input["accel"].(map[string]interface{})
+				if data["linear_accel"] != nil {
+					lin_accel := data["linear_accel"].(map[string]interface{})
 					c.lin_accel = math32.Vector3{
-						X: float32(accel["x"].(float64)),
-						Y: float32(accel["y"].(float64)),
-						Z: float32(accel["z"].(float64)),
+						X: float32(lin_accel["x"].(float64)),
+						Y: float32(lin_accel["y"].(float64)),
+						Z: float32(lin_accel["z"].(float64)),
 					}
 					c.lin_accel.ApplyQuaternion(qRobotProjection)
+					//! needs to be converted to global frame
+					//c.lin_accel.ApplyQuaternion(&c.orin)
+					// c.of_d.Add(&c.lin_accel) // dead reckoning
+					// Integrate acceleration to update position
+						// dt := float32(1) / 10 // assuming a fixed time step, you may need to adjust this
+						// c.lin_accel_v.Add(c.lin_accel.MultiplyScalar(dt))
+						// c.of_d.Add(c.lin_accel_v.MultiplyScalar(dt).MultiplyScalar(10))
 				}
-				if sensor_input["of"] != nil {
-					of := sensor_input["of"].(map[string]interface{})
-					c.of_d = math32.Vector3{
-						X: float32(of["x"].(float64)),
-						Y: float32(of["y"].(float64)),
-						Z: float32(of["z"].(float64)),
-					}
-					c.of_d.ApplyQuaternion(qRobotProjection)
-				}
-			}
-			if data["state"] != nil {
-				state := data["state"].(map[string]interface{})
-
-				c.x[0] = float32(state["x"].(float64))
-				c.x[1] = float32(state["y"].(float64))
-				c.x[2] = float32(state["z"].(float64))
-				c.x[3] = float32(state["vx"].(float64))
-				c.x[4] = float32(state["vy"].(float64))
-				c.x[5] = float32(state["vz"].(float64))
-
-				c.x_pos = math32.Vector3{
-					X: float32(state["x"].(float64)),
-					Y: -float32(state["y"].(float64)),
-					Z: -float32(state["z"].(float64)),
-				}
-				c.x_pos.ApplyQuaternion(qRobotProjection)
-				c.x_pos.MultiplyScalar(float32(c.posS))
-
-				if data["f"] != nil {
-					// We are in predict step
-					// if state["dt"] != nil {
-					dt := float32(state["dt"].(float64))
-					c.predict_cpu = dt / (1.0 / 50) // 50 Hz predict
-					// }
-				} else if data["y-h"] != nil {
-					// We are in update step
-					// if state["dt"] != nil {
-					dt := float32(state["dt"].(float64))
-					c.update_cpu = dt / (1.0 / 10) // 10 Hz update
-					// }
-				}
-				fmt.Printf("predict_cpu: %.2f, update_cpu: %.2f\n", c.predict_cpu, c.update_cpu)
-
-				// //! temp for testing
-				// c.of_d = math32.Vector3{
-				// 	X: float32(state["x"].(float64)),
-				// 	Y: -float32(state["y"].(float64)),
-				// 	Z: -float32(state["z"].(float64)),
-				// }
-				// c.of_d.ApplyQuaternion(qRobotProjection)
-				// c.of_d.MultiplyScalar(float32(c.posS))
-
-				// c.of_d.ApplyQuaternion(&c.orin)
-			}
-
-			if data["P"] != nil {
-				for i := 0; i < 6*6; i++ {
-					c.P[i] = float32(data["P"].([]interface{})[i].(float64))
-				}
-				// fmt.Printf("P: %+v\n", c.P)
 			}
+		*/
 
-			if data["f"] != nil {
-				for i := 0; i < 6; i++ {
-					c.f[i] = float32(data["f"].([]interface{})[i].(float64))
-				}
-				// fmt.Printf("f: %+v\n", c.f)
+		if msg.Quat != nil {
+			c.setOrientation(*msg.Quat)
+		}
+		if msg.Accel != nil {
+			c.accel_f = *msg.Accel
+			c.lin_accel = *msg.Accel
+			c.lin_accel.ApplyQuaternion(qRobotProjection)
+		}
+		if msg.OF != nil {
+			c.of_f = *msg.OF
+			c.of_d = *msg.OF
+			c.of_d.ApplyQuaternion(qRobotProjection)
+		}
+		if state := msg.State; state != nil {
+			c.x[0] = state.X
+			c.x[1] = state.Y
+			c.x[2] = state.Z
+			c.x[3] = state.VX
+			c.x[4] = state.VY
+			c.x[5] = state.VZ
+			c.updatePosition()
+
+			switch msg.Kind() {
+			case KindPredict:
+				// We are in predict step
+				c.predict_cpu = state.DT / (1.0 / 50) // 50 Hz predict
+			case KindUpdate:
+				// We are in update step
+				c.update_cpu = state.DT / (1.0 / 10) // 10 Hz update
 			}
+			fmt.Printf("predict_cpu: %.2f, update_cpu: %.2f\n", c.predict_cpu, c.update_cpu)
 
-			if data["K"] != nil {
-				for i := 0; i < 3*6; i++ {
-					c.K[i] = float32(data["K"].([]interface{})[i].(float64))
-				}
-				// fmt.Printf("K: %+v\n", c.K)
-			}
+			// //! temp for testing
+			// c.of_d = math32.Vector3{
+			// 	X: float32(state["x"].(float64)),
+			// 	Y: -float32(state["y"].(float64)),
+			// 	Z: -float32(state["z"].(float64)),
+			// }
+			// c.of_d.ApplyQuaternion(qRobotProjection)
+			// c.of_d.MultiplyScalar(float32(c.posS))
 
-			if data["y-h"] != nil {
-				for i := 0; i < 3; i++ {
-					c.yh[i] = float32(data["y-h"].([]interface{})[i].(float64))
-				}
-				// fmt.Printf("yh: %+v\n", c.yh)
-			}
+			// c.of_d.ApplyQuaternion(&c.orin)
+		}
 
-			// Ensure history buffers are initialized
-			if len(c.lin_accel_a) == 0 {
-				c.lin_accel_a = make([]math32.Vector3, c.historySize)
-			}
-			if len(c.orin_e_a) == 0 {
-				c.orin_e_a = make([]math32.Vector3, c.historySize)
-			}
-			if len(c.of_d_a) == 0 {
-				c.of_d_a = make([]math32.Vector3, c.historySize)
-			}
-			if len(c.x_pos_a) == 0 {
-				c.x_pos_a = make([]math32.Vector3, c.historySize)
-			}
+		if msg.P != nil {
+			copy(c.P, msg.P)
+			// fmt.Printf("P: %+v\n", c.P)
+		}
 
-			// Shift history buffers back by one
-			for i := len(c.lin_accel_a) - 1; i > 0; i-- {
-				c.lin_accel_a[i] = c.lin_accel_a[i-1]
-			}
-			c.lin_accel_a[0] = c.lin_accel
+		if msg.F != nil {
+			copy(c.f, msg.F)
+			// fmt.Printf("f: %+v\n", c.f)
+		}
 
-			for i := len(c.orin_e_a) - 1; i > 0; i-- {
-				c.orin_e_a[i] = c.orin_e_a[i-1]
-			}
-			c.orin_e_a[0] = c.orin_e
+		if msg.K != nil {
+			copy(c.K, msg.K)
+			// fmt.Printf("K: %+v\n", c.K)
+		}
 
-			for i := len(c.of_d_a) - 1; i > 0; i-- {
-				c.of_d_a[i] = c.of_d_a[i-1]
-			}
-			c.of_d_a[0] = c.of_d
+		if msg.YH != nil {
+			copy(c.yh, msg.YH)
+			// fmt.Printf("yh: %+v\n", c.yh)
+		}
 
-			for i := len(c.x_pos_a) - 1; i > 0; i-- {
-				c.x_pos_a[i] = c.x_pos_a[i-1]
-			}
-			c.x_pos_a[0] = c.x_pos
+		// Record history, messages without micros share the last timestamp
+		kind := msg.Kind()
+		if msg.Accel != nil {
+			c.lin_accel_a.Push(Sample[math32.Vector3]{T: c.t, Kind: kind, Value: c.lin_accel})
+		}
+		if msg.Quat != nil {
+			c.orin_e_a.Push(Sample[math32.Vector3]{T: c.t, Kind: kind, Value: c.orin_e})
+		}
+		if msg.OF != nil {
+			c.of_d_a.Push(Sample[math32.Vector3]{T: c.t, Kind: kind, Value: c.of_d})
+		}
+		if msg.P != nil {
+			var P [6 * 6]float32
+			copy(P[:], c.P)
+			c.P_a.Push(Sample[[6 * 6]float32]{T: c.t, Kind: kind, Value: P})
+		}
+		if msg.K != nil {
+			var K [3 * 6]float32
+			copy(K[:], c.K)
+			c.K_a.Push(Sample[[3 * 6]float32]{T: c.t, Kind: kind, Value: K})
+		}
+		if msg.State != nil {
+			c.x_pos_a.Push(Sample[math32.Vector3]{T: c.t, Kind: kind, Value: c.x_pos})
+			c.x_stat_a.Push(Sample[stateScalars]{T: c.t, Kind: kind, Value: stateScalars{
+				Speed:  math32.Sqrt(c.x[3]*c.x[3] + c.x[4]*c.x[4] + c.x[5]*c.x[5]),
+				PTrace: c.P[0] + c.P[7] + c.P[14],
+				Innov:  math32.Sqrt(c.yh[0]*c.yh[0] + c.yh[1]*c.yh[1] + c.yh[2]*c.yh[2]),
+				PPos:   posCovariance(c.P),
+			}})
+		}
 
-			// fmt.Printf("Optical Flow Delta: %+v\n", c.of_d)
-			// fmt.Printf("Orientation Quaternion: %+v\n", c.orin)
-			// fmt.Printf("Orientation Euler: %+v\n", c.orin_e)
-			c.rso = false // release flag
+		// fmt.Printf("Optical Flow Delta: %+v\n", c.of_d)
+		// fmt.Printf("Orientation Quaternion: %+v\n", c.orin)
+		// fmt.Printf("Orientation Euler: %+v\n", c.orin_e)
+		c.dirty = true
 
-			// Update graphs
-			// if c.updateGraphsFunc != nil {
-			// 	c.updateGraphsFunc()
-			// }
-		}()
+		// Update graphs
+		// if c.updateGraphsFunc != nil {
+		// 	c.updateGraphsFunc()
+		// }
 	}
 }
+
+// setOrientation takes a device quaternion into the scene
+func (c *Connector) setOrientation(q math32.Quaternion) {
+	c.orin = q
+	// Flip Z, Rotate by 90 on X axis, Rotate by 90 on Z axis
+	c.orin = *c.orin.MultiplyQuaternions(qRobotProjection, &c.orin)
+	// Convert to Euler
+	c.orin_e.SetFromQuaternion(&c.orin)
+	c.orin_e.MultiplyScalar(180 / math32.Pi)
+	c.orin_e.X += 90 //? not sure why this is needed
+}
+
+// updatePosition places the device in the scene from the state vector
+func (c *Connector) updatePosition() {
+	c.x_pos = sceneFrame(math32.Vector3{X: c.x[0], Y: c.x[1], Z: c.x[2]})
+	c.x_pos.MultiplyScalar(float32(c.posS))
+}
@@ -0,0 +1,28 @@
+package app
+
+// ConnState is the lifecycle state of the Connector's active source
+type ConnState int
+
+const (
+	StateIdle ConnState = iota
+	StateConnecting
+	StateConnected
+	StateError
+	StateDisconnected
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateIdle:
+		return "Idle"
+	case StateConnecting:
+		return "Connecting"
+	case StateConnected:
+		return "Connected"
+	case StateError:
+		return "Error"
+	case StateDisconnected:
+		return "Disconnected"
+	}
+	return "Unknown"
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"math"
+
+	"github.com/g3n/engine/geometry"
+	"github.com/g3n/engine/graphic"
+	"github.com/g3n/engine/material"
+	"github.com/g3n/engine/math32"
+)
+
+// Covariance ellipsoid sizes, in standard deviations along each axis
+var covSigmas = []struct {
+	name  string
+	sigma float32
+}{
+	{"Off", 0},
+	{"1 sigma", 1},
+	{"2 sigma", 2},
+	{"3 sigma", 3},
+}
+
+// Intervals between the ellipsoids left along the trail
+var covGhostIntervals = []struct {
+	name    string
+	seconds float64
+}{
+	{"None", 0},
+	{"0.5 s", 0.5},
+	{"1 s", 1},
+	{"2 s", 2},
+	{"5 s", 5},
+}
+
+const (
+	covOpacity   = 0.25
+	covGhosts    = 64   // most ellipsoids left along the trail
+	covMinRadius = 1e-3 // scene units, keeps the scale invertible
+)
+
+var covColor = math32.Color{R: 1, G: 0.6, B: 0}
+
+// posCovariance returns the upper triangle (xx xy xz yy yz zz) of the
+// position block of the 6x6 state covariance P
+func posCovariance(P math32.ArrayF32) [6]float32 {
+	return [6]float32{P[0], P[1], P[2], P[7], P[8], P[14]}
+}
+
+// eigenSym3 diagonalises the symmetric 3x3 matrix m with cyclic Jacobi
+// rotations. The eigenvectors are the columns of vecs.
+func eigenSym3(m [3][3]float64) (vals [3]float64, vecs [3][3]float64) {
+	a := m
+	vecs = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 16; sweep++ {
+		off := a[0][1]*a[0][1] + a[0][2]*a[0][2] + a[1][2]*a[1][2]
+		if off < 1e-30 {
+			break
+		}
+		for p := 0; p < 2; p++ {
+			for q := p + 1; q < 3; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				// Rotation angle that zeroes a[p][q]
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < 3; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p] = c*akp - s*akq
+					a[k][q] = s*akp + c*akq
+				}
+				for k := 0; k < 3; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k] = c*apk - s*aqk
+					a[q][k] = s*apk + c*aqk
+				}
+				for k := 0; k < 3; k++ {
+					vkp, vkq := vecs[k][p], vecs[k][q]
+					vecs[k][p] = c*vkp - s*vkq
+					vecs[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+	return [3]float64{a[0][0], a[1][1], a[2][2]}, vecs
+}
+
+// placeEllipsoid shapes the unit sphere mesh into the sigma ellipsoid of
+// the position covariance p (m^2) centred at pos. The axes go through
+// sceneFrame like x_pos, and are scaled to cm.
+func placeEllipsoid(mesh *graphic.Mesh, pos *math32.Vector3, p [6]float32, sigma float32) {
+	vals, vecs := eigenSym3([3][3]float64{
+		{float64(p[0]), float64(p[1]), float64(p[2])},
+		{float64(p[1]), float64(p[3]), float64(p[4])},
+		{float64(p[2]), float64(p[4]), float64(p[5])},
+	})
+
+	var axes [3]math32.Vector3
+	var radii [3]float32
+	for i := range axes {
+		axes[i] = sceneFrame(math32.Vector3{X: float32(vecs[0][i]), Y: float32(vecs[1][i]), Z: float32(vecs[2][i])})
+		radii[i] = sigma * posScale * float32(math.Sqrt(math.Max(vals[i], 0)))
+		if radii[i] < covMinRadius {
+			radii[i] = covMinRadius
+		}
+	}
+	// Keep a right handed basis, the ellipsoid is symmetric either way
+	var cross math32.Vector3
+	cross.CrossVectors(&axes[0], &axes[1])
+	if cross.Dot(&axes[2]) < 0 {
+		axes[2].Negate()
+	}
+
+	var basis math32.Matrix4
+	basis.MakeBasis(&axes[0], &axes[1], &axes[2])
+	var q math32.Quaternion
+	q.SetFromRotationMatrix(&basis)
+	mesh.SetPositionVec(pos)
+	mesh.SetRotationQuat(&q)
+	mesh.SetScale(radii[0], radii[1], radii[2])
+}
+
+// setupCovariance creates the live ellipsoid and the trail ellipsoids
+func (a *App) setupCovariance() {
+	a.cov_g = geometry.NewSphere(1, 24, 16)
+	cov_m := material.NewStandard(&covColor)
+	cov_m.SetTransparent(true)
+	cov_m.SetOpacity(covOpacity)
+	cov_m.SetDepthMask(false)
+	a.cov = graphic.NewMesh(a.cov_g, cov_m)
+	a.cov.SetVisible(false)
+	a.scene.Add(a.cov)
+
+	// Each trail ellipsoid fades on its own
+	a.cov_ghosts = make([]*graphic.Mesh, covGhosts)
+	a.cov_ghost_m = make([]*material.Standard, covGhosts)
+	for i := range a.cov_ghosts {
+		a.cov_ghost_m[i] = material.NewStandard(&covColor)
+		a.cov_ghost_m[i].SetTransparent(true)
+		a.cov_ghost_m[i].SetDepthMask(false)
+		a.cov_ghosts[i] = graphic.NewMesh(a.cov_g, a.cov_ghost_m[i])
+		a.cov_ghosts[i].SetVisible(false)
+		a.scene.Add(a.cov_ghosts[i])
+	}
+}
+
+// updateCovariance follows the device with the live ellipsoid and places
+// the trail ellipsoids at every interval within the trail window, newest
+// first
+func (a *App) updateCovariance(snap *filterState, pos *math32.Vector3) {
+	sigma := covSigmas[a.cov_sigma].sigma
+	a.cov.SetVisible(sigma > 0)
+	if sigma > 0 {
+		placeEllipsoid(a.cov, pos, posCovariance(snap.P), sigma)
+	}
+
+	shown := 0
+	interval := covGhostIntervals[a.cov_ghost].seconds
+	if sigma > 0 && interval > 0 {
+		h, stats := snap.x_pos_a, snap.x_stat_a
+		oldest := snap.t - a.histWindow
+		if a.trail_from > oldest {
+			oldest = a.trail_from
+		}
+		for t := math.Floor(snap.t/interval) * interval; t >= oldest && shown < covGhosts; t -= interval {
+			i := searchTime(h, t)
+			if i == h.Len() {
+				continue
+			}
+			s := h.At(i)
+			gpos := s.Value
+			gpos.Add(&a.pos_offset)
+			placeEllipsoid(a.cov_ghosts[shown], &gpos, stats.At(i).Value.PPos, sigma)
+			// Fade out over the trail window
+			fade := 1 - (snap.t-s.T)/a.histWindow
+			a.cov_ghost_m[shown].SetOpacity(covOpacity * float32(math.Max(fade, 0)))
+			a.cov_ghosts[shown].SetVisible(true)
+			shown++
+		}
+	}
+	for i := shown; i < covGhosts; i++ {
+		a.cov_ghosts[i].SetVisible(false)
+	}
+}
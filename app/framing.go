@@ -0,0 +1,200 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Framing selects how frames are delimited on a byte stream
+type Framing int
+
+const (
+	FramingAuto   Framing = iota // detect between lines and COBS
+	FramingLines                 // newline-delimited
+	FramingCOBS                  // 0x00-delimited COBS binary
+	FramingLength                // u16 little-endian length prefix
+)
+
+// Consecutive frames of one framing needed before auto-detection locks in
+const framingLockCount = 8
+
+// Longest delimited frame kept, longer ones are skipped up to their
+// delimiter instead of buffering a stream that never delimits
+const maxFrameLen = 64 * 1024
+
+// frameReader splits a byte stream into frames
+type frameReader struct {
+	r       *bufio.Reader
+	framing Framing
+
+	lastDelim byte // ending the frame last read by readUntil
+
+	// Set for binary payloads on lines framing, reports a line that was
+	// cut short by a '\n' inside the payload
+	truncated func([]byte) bool
+
+	// Auto-detection
+	candidate Framing
+	streak    int
+	locked    atomic.Int32 // framing, for writers on other goroutines
+}
+
+func newFrameReader(r io.Reader, framing Framing) *frameReader {
+	f := &frameReader{r: bufio.NewReader(r), framing: framing}
+	f.locked.Store(int32(framing))
+	return f
+}
+
+// Framing returns the framing of the stream, FramingAuto until detection
+// locks in. Safe to call while another goroutine reads.
+func (f *frameReader) Framing() Framing {
+	return Framing(f.locked.Load())
+}
+
+// ReadFrame returns the next non-empty frame without its delimiter
+func (f *frameReader) ReadFrame() ([]byte, error) {
+	for {
+		var frame []byte
+		var err error
+		framing := f.framing
+		switch framing {
+		case FramingAuto:
+			frame, framing, err = f.readAuto()
+		case FramingCOBS:
+			frame, err = f.readUntil("\x00")
+		case FramingLength:
+			frame, err = f.readPrefixed()
+		default:
+			frame, err = f.readLine()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(frame) == 0 {
+			continue
+		}
+		f.detected(framing)
+		return frame, nil
+	}
+}
+
+// readAuto reads up to whichever delimiter comes first. JSON lines start
+// with '{', so anything else ending in a newline is the rest of a line the
+// port was opened in, or a boot banner, and is skipped. A JSON stream never
+// contains 0x00, so frames ending in one are taken as COBS.
+func (f *frameReader) readAuto() ([]byte, Framing, error) {
+	for {
+		frame, err := f.readUntil("\x00\n")
+		if err != nil {
+			return nil, FramingAuto, err
+		}
+		delim := f.lastDelim
+		if delim == 0x00 {
+			return frame, FramingCOBS, nil
+		}
+		if bytes.HasPrefix(frame, []byte{'{'}) {
+			return frame, FramingLines, nil
+		}
+	}
+}
+
+// readUntil returns the bytes before the next of delims, remembering the
+// delimiter in lastDelim. Frames over maxFrameLen are dropped.
+func (f *frameReader) readUntil(delims string) ([]byte, error) {
+	var frame []byte
+	skipping := false
+	for {
+		// Wait for at least one byte, then look through what is buffered
+		if _, err := f.r.Peek(1); err != nil {
+			return nil, err
+		}
+		buf, _ := f.r.Peek(f.r.Buffered())
+		i := bytes.IndexAny(buf, delims)
+		n := len(buf)
+		if i >= 0 {
+			n = i
+		}
+		if !skipping {
+			frame = append(frame, buf[:n]...)
+			if len(frame) > maxFrameLen {
+				fmt.Printf("Skipping frame longer than %d bytes\n", maxFrameLen)
+				skipping, frame = true, nil
+			}
+		}
+		if i < 0 {
+			f.r.Discard(n)
+			continue
+		}
+		f.lastDelim = buf[i]
+		f.r.Discard(i + 1)
+		if skipping {
+			skipping = false
+			continue
+		}
+		return frame, nil
+	}
+}
+
+// readLine reads up to the next newline. Only the newline is stripped,
+// binary payloads may end in '\r', and a line the truncated check rejects
+// is joined with the next.
+func (f *frameReader) readLine() ([]byte, error) {
+	frame, err := f.readUntil("\n")
+	for err == nil && f.truncated != nil && len(frame) > 0 && f.truncated(frame) {
+		var more []byte
+		if more, err = f.readUntil("\n"); err != nil {
+			break
+		}
+		if len(frame)+1+len(more) > maxFrameLen {
+			fmt.Printf("Skipping frame longer than %d bytes\n", maxFrameLen)
+			return nil, nil
+		}
+		frame = append(append(frame, '\n'), more...)
+	}
+	return frame, err
+}
+
+func (f *frameReader) readPrefixed() ([]byte, error) {
+	var prefix [2]byte
+	if _, err := io.ReadFull(f.r, prefix[:]); err != nil {
+		return nil, err
+	}
+	frame := make([]byte, binary.LittleEndian.Uint16(prefix[:]))
+	if _, err := io.ReadFull(f.r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// detected locks auto-detection once enough frames agree on the framing
+func (f *frameReader) detected(framing Framing) {
+	if f.framing != FramingAuto {
+		return
+	}
+	if framing != f.candidate {
+		f.candidate = framing
+		f.streak = 0
+	}
+	f.streak++
+	if f.streak >= framingLockCount {
+		f.framing = framing
+		f.locked.Store(int32(framing))
+	}
+}
+
+// delimit frames data for writing, streams still being detected get
+// newlines
+func delimit(frame []byte, framing Framing) []byte {
+	switch framing {
+	case FramingCOBS:
+		return append(frame, 0x00)
+	case FramingLength:
+		prefix := binary.LittleEndian.AppendUint16(nil, uint16(len(frame)))
+		return append(prefix, frame...)
+	}
+	return append(frame, '\n')
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func readFrames(t *testing.T, fr *frameReader) []string {
+	t.Helper()
+	var frames []string
+	for {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			return frames
+		}
+		frames = append(frames, string(frame))
+	}
+}
+
+func TestAutoFramingResync(t *testing.T) {
+	// Opened mid-line, then a boot banner
+	in := "0.5,\"y\":1}}\nLocationCore v1\r\n{\"micros\":1}\n{\"micros\":2}\n"
+	frames := readFrames(t, newFrameReader(strings.NewReader(in), FramingAuto))
+	if want := []string{`{"micros":1}`, `{"micros":2}`}; strings.Join(frames, " ") != strings.Join(want, " ") {
+		t.Errorf("frames %q, want %q", frames, want)
+	}
+
+	var cobs []byte
+	for i := uint32(0); i < framingLockCount; i++ {
+		cobs = append(append(cobs, binaryFrame(i)...), 0x00)
+	}
+	fr := newFrameReader(bytes.NewReader(append([]byte("\x13\x37"), cobs...)), FramingAuto)
+	frames = readFrames(t, fr)
+	// Leading junk joins the first frame, which then fails its CRC check
+	if len(frames) != framingLockCount || fr.Framing() != FramingCOBS {
+		t.Errorf("%d frames, framing %d", len(frames), fr.Framing())
+	}
+}
+
+func TestFrameLengthCap(t *testing.T) {
+	in := append(bytes.Repeat([]byte{0x01}, maxFrameLen+1), 0x00, 0x02, 0x05, 0x00)
+	frames := readFrames(t, newFrameReader(bytes.NewReader(in), FramingCOBS))
+	if len(frames) != 1 || frames[0] != "\x02\x05" {
+		t.Errorf("frames %q", frames)
+	}
+}
+
+func TestLinesFramingRejoin(t *testing.T) {
+	// micros 10 ends in 0x0A, the newline delimiter
+	frame := "\x81\xa6micros\x0a"
+	in := strings.Repeat(frame+"\n", 3)
+	frames := readFrames(t, FormatMsgPackLines.frameReader(strings.NewReader(in)))
+	if len(frames) != 3 {
+		t.Fatalf("frames %q", frames)
+	}
+	for _, f := range frames {
+		if msg, err := FormatMsgPackLines.Decode([]byte(f)); err != nil || msg.Micros != 10 {
+			t.Errorf("frame %q: %v", f, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package app
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/g3n/engine/gui"
+	"github.com/g3n/engine/math32"
+)
+
+// Heatmap cell and colour bar sizes, pixels
+const (
+	heatmapCellH   = 16
+	heatmapBarH    = 8
+	heatmapBarStep = 32
+)
+
+var (
+	heatmapZero     = math32.Color{R: 0.3, G: 0.3, B: 0.3}
+	heatmapBorder   = math32.Color4{R: 0.15, G: 0.15, B: 0.15, A: 1}
+	heatmapSelected = math32.Color4{R: 1, G: 1, B: 1, A: 1}
+)
+
+// Heatmap shows a matrix as cells coloured on a log scale of |value|.
+// Negative cells are marked with a minus, zero cells are grey. Clicking a
+// cell selects it.
+type Heatmap struct {
+	gui.Panel
+	rows, cols int
+	cells      []*gui.Panel
+	signs      []*gui.Label
+	bar        []*gui.Panel
+	lo_l, hi_l *gui.Label
+	cmap       *Colormap
+	selected   int // cell index, -1 for none
+	onSelect   func(row, col int)
+
+	// Texts shown, see setText
+	sign_txt       []string
+	lo_txt, hi_txt string
+}
+
+func NewHeatmap(width float32, rows, cols int, onSelect func(row, col int)) *Heatmap {
+	hm := new(Heatmap)
+	hm.Panel.Initialize(hm, width, 0)
+	hm.rows, hm.cols = rows, cols
+	hm.cmap = &colormaps[0]
+	hm.selected = -1
+	hm.onSelect = onSelect
+
+	hm_vb := gui.NewVBoxLayout()
+	hm_vb.SetAutoHeight(true)
+	hm_vb.SetSpacing(2)
+	hm.SetLayout(hm_vb)
+
+	cellW := width / float32(cols)
+	hm.cells = make([]*gui.Panel, rows*cols)
+	hm.signs = make([]*gui.Label, rows*cols)
+	hm.sign_txt = make([]string, rows*cols)
+	for r := 0; r < rows; r++ {
+		row_p := gui.NewPanel(width, heatmapCellH)
+		row_p.SetLayout(gui.NewHBoxLayout())
+		hm.Add(row_p)
+		for c := 0; c < cols; c++ {
+			i := r*cols + c
+			cell := gui.NewPanel(cellW, heatmapCellH)
+			cell.SetBorders(1, 1, 1, 1)
+			cell.SetBordersColor4(&heatmapBorder)
+			cell.SetColor(&heatmapZero)
+			cell.SetLayout(gui.NewHBoxLayout())
+			hm.signs[i] = gui.NewLabel(" ")
+			hm.sign_txt[i] = " "
+			cell.Add(hm.signs[i])
+			cell.Subscribe(gui.OnMouseDown, func(evname string, ev interface{}) {
+				hm.Select(i/hm.cols, i%hm.cols)
+				if hm.onSelect != nil {
+					hm.onSelect(i/hm.cols, i%hm.cols)
+				}
+			})
+			hm.cells[i] = cell
+			row_p.Add(cell)
+		}
+	}
+
+	// Log colour bar
+	bar_p := gui.NewPanel(width, heatmapCellH)
+	bar_hb := gui.NewHBoxLayout()
+	bar_hb.SetSpacing(4)
+	bar_p.SetLayout(bar_hb)
+	hm.Add(bar_p)
+	hm.lo_l = gui.NewLabel("")
+	bar_p.Add(hm.lo_l)
+	steps_p := gui.NewPanel(width/2, heatmapBarH)
+	steps_p.SetLayout(gui.NewHBoxLayout())
+	bar_p.Add(steps_p)
+	hm.bar = make([]*gui.Panel, heatmapBarStep)
+	for i := range hm.bar {
+		hm.bar[i] = gui.NewPanel(width/2/heatmapBarStep, heatmapBarH)
+		c := hm.cmap.At(float32(i) / (heatmapBarStep - 1))
+		hm.bar[i].SetColor(&c)
+		steps_p.Add(hm.bar[i])
+	}
+	hm.hi_l = gui.NewLabel("")
+	bar_p.Add(hm.hi_l)
+	return hm
+}
+
+// SetValues colours the cells from vals, row major. The colour range
+// spans the decades of the non-zero magnitudes.
+func (hm *Heatmap) SetValues(vals []float32) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range vals {
+		if m := math.Abs(float64(v)); m > 0 && !math.IsInf(m, 0) {
+			lo = math.Min(lo, math.Log10(m))
+			hi = math.Max(hi, math.Log10(m))
+		}
+	}
+	if lo > hi {
+		lo, hi = 0, 1
+	}
+	lo, hi = math.Floor(lo), math.Ceil(hi)
+	if hi <= lo {
+		hi = lo + 1
+	}
+	setText(hm.lo_l, &hm.lo_txt, fmt.Sprintf("1e%d", int(lo)))
+	setText(hm.hi_l, &hm.hi_txt, fmt.Sprintf("1e%d", int(hi)))
+
+	for i, cell := range hm.cells {
+		v := float64(vals[i])
+		m := math.Abs(v)
+		switch {
+		case m == 0 || math.IsNaN(m):
+			cell.SetColor(&heatmapZero)
+		default:
+			c := hm.cmap.At(float32((math.Log10(m) - lo) / (hi - lo)))
+			cell.SetColor(&c)
+		}
+		if v < 0 {
+			setText(hm.signs[i], &hm.sign_txt[i], "-")
+		} else {
+			setText(hm.signs[i], &hm.sign_txt[i], " ")
+		}
+	}
+}
+
+// setText updates a label only when its text changes, SetText renders and
+// uploads a new texture every time
+func setText(l *gui.Label, shown *string, text string) {
+	if *shown == text {
+		return
+	}
+	*shown = text
+	l.SetText(text)
+}
+
+// Select outlines the cell at row, col
+func (hm *Heatmap) Select(row, col int) {
+	if hm.selected >= 0 {
+		hm.cells[hm.selected].SetBordersColor4(&heatmapBorder)
+	}
+	hm.selected = -1
+	if row >= 0 && row < hm.rows && col >= 0 && col < hm.cols {
+		hm.selected = row*hm.cols + col
+		hm.cells[hm.selected].SetBordersColor4(&heatmapSelected)
+	}
+}
+
+// buildHeatmaps adds the P and K heatmaps to the Kalman tree, and the
+// chart of the element last clicked on
+func (a *App) buildHeatmaps() {
+	width := a.kalman_p_t1.ContentWidth() - 24
+
+	a.k_pc_hm_n = a.kalman_p_t1.AddNode("Covariance Heatmap (P)")
+	a.k_pc_hm = NewHeatmap(width, 6, 6, func(row, col int) {
+		a.selectElement("P", row, col)
+	})
+	a.k_pc_hm_n.Add(a.k_pc_hm)
+	a.k_pc_hm_n.SetExpanded(true)
+
+	a.k_K_hm_n = a.kalman_p_t1.AddNode("Gain Heatmap (K)")
+	a.k_K_hm = NewHeatmap(width, 3, 6, func(row, col int) {
+		a.selectElement("K", row, col)
+	})
+	a.k_K_hm_n.Add(a.k_K_hm)
+	a.k_K_hm_n.SetExpanded(true)
+
+	a.k_el_n = a.kalman_p_t1.AddNode("Element History")
+	a.k_el_l = gui.NewLabel("Click a heatmap cell")
+	a.k_el_n.Add(a.k_el_l)
+	a.k_el_ch = gui.NewChart(width, a.k_el_l.Height()*10)
+	a.k_el_ch.SetMargins(0, 2, 0, 2)
+	a.k_el_ch.SetBorders(2, 2, 2, 2)
+	a.k_el_ch.SetBordersColor(math32.NewColor("black"))
+	a.k_el_ch.SetPaddings(0, 2, 0, 2)
+	a.k_el_ch.SetColor(math32.NewColor("white"))
+	a.k_el_ch.SetRangeYauto(true)
+	a.k_el_ch.SetScaleY(5, &math32.Color{R: 0.8, G: 0.8, B: 0.8})
+	a.k_el_ch.SetFontSizeX(12)
+	a.k_el_ch.SetFormatY("%.3g")
+	a.k_el_ch.SetFormatX("%.1fs")
+	a.k_el_ch.SetScaleX(chartScaleLines, &math32.Color{R: 0.8, G: 0.8, B: 0.8})
+	a.k_el_n.Add(a.k_el_ch)
+	a.k_el_n.SetExpanded(false)
+}
+
+// selectElement charts the history of one element of P or K
+func (a *App) selectElement(matrix string, row, col int) {
+	a.k_el_mat, a.k_el_row, a.k_el_col = matrix, row, col
+	// Only one cell is selected across both heatmaps
+	if matrix != "P" {
+		a.k_pc_hm.Select(-1, -1)
+	}
+	if matrix != "K" {
+		a.k_K_hm.Select(-1, -1)
+	}
+	a.k_el_l.SetText(fmt.Sprintf("%s[%d,%d]", matrix, row, col))
+	a.k_el_n.SetExpanded(true)
+	a.graphs_snap = nil // redraw
+}
+
+// updateHeatmaps colours the heatmaps and redraws the element chart
+func (a *App) updateHeatmaps(snap *filterState) {
+	a.k_pc_hm.SetValues(snap.P)
+	a.k_K_hm.SetValues(snap.K)
+
+	if a.k_el_g != nil {
+		a.k_el_ch.RemoveGraph(a.k_el_g)
+		a.k_el_g = nil
+	}
+	var data []float32
+	from, to := snap.t-a.histWindow, snap.t
+	switch a.k_el_mat {
+	case "P":
+		i := a.k_el_row*6 + a.k_el_col
+		data = resample(snap.P_a, from, to, graphPoints,
+			func(P [6 * 6]float32) float32 { return P[i] }, lerpF32)
+	case "K":
+		i := a.k_el_row*6 + a.k_el_col
+		data = resample(snap.K_a, from, to, graphPoints,
+			func(K [3 * 6]float32) float32 { return K[i] }, lerpF32)
+	}
+	if data != nil {
+		a.k_el_g = a.k_el_ch.AddLineGraph(&math32.Color{R: 0, G: 0, B: 1}, data)
+	}
+}
@@ -0,0 +1,98 @@
+package app
+
+// Samples per History chunk
+const historyChunk = 1024
+
+// History is a fixed-capacity ring buffer of samples, oldest first. It is
+// stored as fixed-size chunks so that a Snapshot shares every full chunk
+// with the live buffer instead of copying minutes of data.
+//
+// Only the owner may Push, snapshots are read-only.
+type History[T any] struct {
+	chunks   [][]T // all full except the last
+	start    int   // evicted elements at the front of chunks[0]
+	capacity int
+	pushed   int // samples pushed over the lifetime, including evicted ones
+}
+
+func NewHistory[T any](capacity int) *History[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &History[T]{capacity: capacity}
+}
+
+// Push appends v, evicting the oldest sample when full
+func (h *History[T]) Push(v T) {
+	last := len(h.chunks) - 1
+	if last < 0 || len(h.chunks[last]) == historyChunk {
+		h.chunks = append(h.chunks, make([]T, 0, historyChunk))
+		last++
+	}
+	// Appends stay within the chunk's capacity, past the end any snapshot sees
+	h.chunks[last] = append(h.chunks[last], v)
+	h.pushed++
+
+	if h.Len() > h.capacity {
+		h.start++
+		if h.start == historyChunk {
+			h.chunks[0] = nil
+			h.chunks = h.chunks[1:]
+			h.start = 0
+		}
+	}
+}
+
+func (h *History[T]) Len() int {
+	if len(h.chunks) == 0 {
+		return 0
+	}
+	return (len(h.chunks)-1)*historyChunk + len(h.chunks[len(h.chunks)-1]) - h.start
+}
+
+// Pushed counts every sample ever pushed, so readers can find the samples
+// added since they last looked
+func (h *History[T]) Pushed() int {
+	return h.pushed
+}
+
+// At returns the i-th oldest sample
+func (h *History[T]) At(i int) T {
+	if i < 0 || i >= h.Len() {
+		panic("history index out of range")
+	}
+	i += h.start
+	return h.chunks[i/historyChunk][i%historyChunk]
+}
+
+// Range calls fn for samples from (inclusive) to to (exclusive), oldest
+// first, clamped to the stored samples
+func (h *History[T]) Range(from, to int, fn func(i int, v T)) {
+	if from < 0 {
+		from = 0
+	}
+	if n := h.Len(); to > n {
+		to = n
+	}
+	for i := from; i < to; {
+		pos := i + h.start
+		chunk := h.chunks[pos/historyChunk]
+		for j := pos % historyChunk; j < len(chunk) && i < to; j++ {
+			fn(i, chunk[j])
+			i++
+		}
+	}
+}
+
+// Snapshot returns a read-only view of the current samples that later
+// pushes do not change
+func (h *History[T]) Snapshot() *History[T] {
+	s := &History[T]{
+		chunks:   make([][]T, len(h.chunks)),
+		start:    h.start,
+		capacity: h.capacity,
+		pushed:   h.pushed,
+	}
+	copy(s.chunks, h.chunks)
+	return s
+}
@@ -0,0 +1,53 @@
+package app
+
+import "testing"
+
+func TestHistoryEviction(t *testing.T) {
+	const capacity = 2*historyChunk + 100
+	h := NewHistory[int](capacity)
+	for i := 0; i < 5*historyChunk; i++ {
+		h.Push(i)
+	}
+	if h.Len() != capacity {
+		t.Fatalf("Len = %d, want %d", h.Len(), capacity)
+	}
+	if h.Pushed() != 5*historyChunk {
+		t.Errorf("Pushed = %d, want %d", h.Pushed(), 5*historyChunk)
+	}
+	oldest := 5*historyChunk - capacity
+	if h.At(0) != oldest || h.At(h.Len()-1) != 5*historyChunk-1 {
+		t.Errorf("first %d, last %d", h.At(0), h.At(h.Len()-1))
+	}
+	if len(h.chunks) > capacity/historyChunk+2 {
+		t.Errorf("%d chunks kept for %d samples", len(h.chunks), capacity)
+	}
+	next := oldest
+	h.Range(0, h.Len(), func(i, v int) {
+		if v != next {
+			t.Fatalf("Range at %d = %d, want %d", i, v, next)
+		}
+		next++
+	})
+}
+
+func TestHistorySnapshot(t *testing.T) {
+	h := NewHistory[int](historyChunk + 10)
+	for i := 0; i < historyChunk+5; i++ {
+		h.Push(i)
+	}
+	s := h.Snapshot()
+	n, first, last := s.Len(), s.At(0), s.At(s.Len()-1)
+
+	// Fills the partial chunk shared with the snapshot, then evicts
+	for i := 0; i < 3*historyChunk; i++ {
+		h.Push(-i)
+	}
+	if s.Len() != n || s.At(0) != first || s.At(s.Len()-1) != last {
+		t.Errorf("snapshot changed: len %d, first %d, last %d", s.Len(), s.At(0), s.At(s.Len()-1))
+	}
+	for i := 0; i < s.Len(); i++ {
+		if s.At(i) != i {
+			t.Fatalf("snapshot At(%d) = %d", i, s.At(i))
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"sync"
+
+	"github.com/g3n/engine/math32"
+)
+
+// Frames waiting for the ingest goroutine before readers block
+const ingestQueueSize = 256
+
+// Frames applied before a snapshot is published, even if more are queued
+const ingestBatchSize = 64
+
+// rawFrame is one frame as read from a source, or a request to clear the
+// filter state when a replay jumps to a keyframe
+type rawFrame struct {
+	data     []byte
+	format   WireFormat
+	replayed bool // not logged again
+	reset    bool
+	state    *replayState // restored after the reset
+}
+
+// filterState is everything the display shows about the filter. The
+// ingest goroutine owns the Connector's copy, the render loop only sees
+// published clones.
+type filterState struct {
+	t     float64 // device time of the last message, seconds
+	epoch int     // counts resets, the display redraws when it changes
+
+	// Kalman State
+	x     math32.ArrayF32
+	x_pos math32.Vector3
+	P     math32.ArrayF32
+	f     math32.ArrayF32
+	K     math32.ArrayF32
+	yh    math32.ArrayF32
+
+	predict_cpu float32
+	update_cpu  float32
+
+	lin_accel math32.Vector3
+	orin      math32.Quaternion
+	orin_e    math32.Vector3
+	of_d      math32.Vector3
+
+	// Measurements as received, in the filter's frame
+	accel_f math32.Vector3
+	of_f    math32.Vector3
+
+	x_pos_a     *History[Sample[math32.Vector3]]
+	lin_accel_a *History[Sample[math32.Vector3]]
+	orin_e_a    *History[Sample[math32.Vector3]]
+	of_d_a      *History[Sample[math32.Vector3]]
+	x_stat_a    *History[Sample[stateScalars]] // one per x_pos_a sample
+	P_a         *History[Sample[[6 * 6]float32]]
+	K_a         *History[Sample[[3 * 6]float32]]
+}
+
+// stateScalars are the per state sample values the trail is coloured and
+// annotated with
+type stateScalars struct {
+	Speed  float32    // m/s
+	PTrace float32    // trace of the position covariance, m^2
+	Innov  float32    // |y-h|
+	PPos   [6]float32 // position covariance, see posCovariance
+}
+
+func newFilterState(historySize int) *filterState {
+	return &filterState{
+		x:  make(math32.ArrayF32, 6),
+		P:  make(math32.ArrayF32, 6*6),
+		f:  make(math32.ArrayF32, 6),
+		K:  make(math32.ArrayF32, 3*6),
+		yh: make(math32.ArrayF32, 3),
+
+		x_pos_a:     NewHistory[Sample[math32.Vector3]](historySize),
+		lin_accel_a: NewHistory[Sample[math32.Vector3]](historySize),
+		orin_e_a:    NewHistory[Sample[math32.Vector3]](historySize),
+		of_d_a:      NewHistory[Sample[math32.Vector3]](historySize),
+		x_stat_a:    NewHistory[Sample[stateScalars]](historySize),
+		P_a:         NewHistory[Sample[[6 * 6]float32]](historySize),
+		K_a:         NewHistory[Sample[[3 * 6]float32]](historySize),
+	}
+}
+
+// clone returns a copy that is safe to hand to another goroutine, the
+// histories share their stored chunks
+func (s *filterState) clone() *filterState {
+	c := *s
+	c.x = append(math32.ArrayF32(nil), s.x...)
+	c.P = append(math32.ArrayF32(nil), s.P...)
+	c.f = append(math32.ArrayF32(nil), s.f...)
+	c.K = append(math32.ArrayF32(nil), s.K...)
+	c.yh = append(math32.ArrayF32(nil), s.yh...)
+	c.x_pos_a = s.x_pos_a.Snapshot()
+	c.lin_accel_a = s.lin_accel_a.Snapshot()
+	c.orin_e_a = s.orin_e_a.Snapshot()
+	c.of_d_a = s.of_d_a.Snapshot()
+	c.x_stat_a = s.x_stat_a.Snapshot()
+	c.P_a = s.P_a.Snapshot()
+	c.K_a = s.K_a.Snapshot()
+	return &c
+}
+
+// ingestRoutine applies frames in arrival order and publishes a snapshot
+// after each batch, it is the only goroutine touching c.filterState
+func (c *Connector) ingestRoutine() {
+	for frame := range c.ingest {
+		c.applyFrame(frame)
+
+		// Apply what is already queued before publishing
+	batch:
+		for i := 1; i < ingestBatchSize; i++ {
+			select {
+			case frame := <-c.ingest:
+				c.applyFrame(frame)
+			default:
+				break batch
+			}
+		}
+
+		if c.dirty {
+			c.snapshot.Store(c.filterState.clone())
+			c.dirty = false
+		}
+	}
+}
+
+func (c *Connector) applyFrame(frame rawFrame) {
+	if frame.reset {
+		c.resetState()
+		if frame.state != nil {
+			c.restoreState(frame.state)
+		}
+		return
+	}
+	c.portRecvCb(frame.data, frame.format, !frame.replayed)
+}
+
+// resetState starts the filter state and history over, keeping nothing
+// from the old timeline
+func (c *Connector) resetState() {
+	epoch := c.epoch + 1
+	c.filterState = newFilterState(c.historySize)
+	c.epoch = epoch
+	c.clock = deviceClock{}
+	c.link.reset()
+	c.dirty = true
+}
+
+// restoreState applies a replay keyframe, the history is left empty for
+// the frames after it to fill
+func (c *Connector) restoreState(s *replayState) {
+	copy(c.x, s.x[:])
+	c.updatePosition()
+	copy(c.P, s.P[:])
+	if s.quat != (math32.Quaternion{}) {
+		c.setOrientation(s.quat)
+	}
+}
+
+// Snapshot returns the latest published filter state, never nil. It must
+// not be modified.
+func (c *Connector) Snapshot() *filterState {
+	if s := c.snapshot.Load(); s != nil {
+		return s
+	}
+	return c.empty
+}
+
+// noticeQueue collects serial monitor lines from background goroutines,
+// the GUI adds them to the monitor from the render loop
+type noticeQueue struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (q *noticeQueue) push(line string) {
+	q.mu.Lock()
+	q.lines = append(q.lines, line)
+	q.mu.Unlock()
+}
+
+func (q *noticeQueue) drain() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	lines := q.lines
+	q.lines = nil
+	return lines
+}
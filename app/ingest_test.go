@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestIngestOrder(t *testing.T) {
+	const frames = 500
+
+	c := &Connector{}
+	c.setUpdateGraphsFunc(nil, frames, 1)
+	src := NewMemorySource("test", FormatJSON, 16)
+	c.Connect(src)
+	defer c.Disconnect()
+
+	go func() {
+		for i := 0; i < frames; i++ {
+			src.Push([]byte(fmt.Sprintf(`{"micros": %d, "state": {"x": %d, "y": 0, "z": 0, "vx": 0, "vy": 0, "vz": 0, "dt": 0}}`,
+				i*nominalPeriodMicros, i)))
+		}
+		src.End()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	snap := c.Snapshot()
+	for snap.x_pos_a.Pushed() < frames {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d frames ingested", snap.x_pos_a.Pushed(), frames)
+		}
+		time.Sleep(time.Millisecond)
+		snap = c.Snapshot()
+	}
+
+	if snap.x_pos_a.Len() != frames {
+		t.Fatalf("history holds %d samples, want %d", snap.x_pos_a.Len(), frames)
+	}
+	for i := 0; i < frames; i++ {
+		want := float64(i) * nominalPeriodMicros / 1e6
+		if got := snap.x_pos_a.At(i).T; got != want {
+			t.Fatalf("sample %d at %v, want %v", i, got, want)
+		}
+	}
+	if snap.x[0] != frames-1 {
+		t.Errorf("state x = %v, want %d", snap.x[0], frames-1)
+	}
+	stats := c.LinkStats()
+	if stats.Received != frames || stats.Lost != 0 || stats.Reordered != 0 {
+		t.Errorf("link stats: %s", stats)
+	}
+}
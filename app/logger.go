@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// CSV logger queue and flushing, rows reach the file at least every
+// logFlushInterval, or sooner once logFlushBytes are buffered
+const (
+	logQueueSize     = 4096
+	logFlushInterval = 500 * time.Millisecond
+	logFlushBytes    = 64 * 1024
+)
+
+// csvLogger writes CSV rows in order from its own goroutine, so that
+// logging never blocks ingest. Rows are dropped, and counted, when the
+// queue is full.
+type csvLogger struct {
+	rows    chan []string
+	done    chan struct{}
+	dropped atomic.Int64
+
+	file *os.File
+	w    *csv.Writer
+}
+
+func newCSVLogger(file *os.File) *csvLogger {
+	l := &csvLogger{
+		rows: make(chan []string, logQueueSize),
+		done: make(chan struct{}),
+		file: file,
+		// csv.Writer keeps a bufio.Writer that is at least the default size
+		w: csv.NewWriter(bufio.NewWriterSize(file, logFlushBytes)),
+	}
+	go l.run()
+	return l
+}
+
+// write queues a row without blocking, reporting false if it was dropped.
+// It must not be called after close.
+func (l *csvLogger) write(row []string) bool {
+	select {
+	case l.rows <- row:
+		return true
+	default:
+		l.dropped.Add(1)
+		return false
+	}
+}
+
+// stop ends the queue, the logger goroutine then writes out the queued
+// rows and closes the file. No row may be written after it.
+func (l *csvLogger) stop() {
+	close(l.rows)
+}
+
+// wait blocks until the file is closed after stop
+func (l *csvLogger) wait() {
+	<-l.done
+}
+
+// Dropped counts the rows lost to a full queue
+func (l *csvLogger) Dropped() int {
+	return int(l.dropped.Load())
+}
+
+func (l *csvLogger) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	var reported int64
+	for {
+		select {
+		case row, ok := <-l.rows:
+			if !ok {
+				l.finish()
+				return
+			}
+			if err := l.w.Write(row); err != nil {
+				fmt.Println("Error writing to log file:", err)
+			}
+		case <-ticker.C:
+			l.w.Flush()
+			if err := l.w.Error(); err != nil {
+				fmt.Println("Error flushing log file:", err)
+			}
+			if d := l.dropped.Load(); d > reported {
+				fmt.Printf("Log queue full, dropped %d rows\n", d-reported)
+				reported = d
+			}
+		}
+	}
+}
+
+func (l *csvLogger) finish() {
+	l.w.Flush()
+	if err := l.w.Error(); err != nil {
+		fmt.Println("Error flushing log file:", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		fmt.Println("Error syncing log file:", err)
+	}
+	if err := l.file.Close(); err != nil {
+		fmt.Println("Error closing log file:", err)
+	}
+	if d := l.dropped.Load(); d > 0 {
+		fmt.Printf("Log closed, %d rows dropped in total\n", d)
+	}
+}
@@ -0,0 +1,215 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/g3n/engine/math32"
+)
+
+// MessageKind tells which step of the filter produced a message
+type MessageKind int
+
+const (
+	KindSensor  MessageKind = iota // sensor input only
+	KindPredict                    // predict step, carries f
+	KindUpdate                     // update step, carries K and y-h
+)
+
+func (k MessageKind) String() string {
+	switch k {
+	case KindPredict:
+		return "predict"
+	case KindUpdate:
+		return "update"
+	}
+	return "sensor"
+}
+
+// State is the Kalman state vector as sent by the firmware
+type State struct {
+	X, Y, Z    float32
+	VX, VY, VZ float32
+	DT         float32
+}
+
+// Message is one decoded LocationCore message, absent parts are nil
+type Message struct {
+	Micros    float64
+	HasMicros bool
+
+	// sensor_input, in the device frame
+	Quat  *math32.Quaternion
+	Accel *math32.Vector3
+	OF    *math32.Vector3
+
+	State *State
+
+	P  []float32 // 6x6 state error covariance
+	F  []float32 // 6 state transition
+	K  []float32 // 3x6 Kalman gain
+	YH []float32 // 3 innovation
+
+	// Reply to a command, acknowledgements carry no other fields
+	Ack *Ack
+}
+
+func (m *Message) Kind() MessageKind {
+	if m.F != nil {
+		return KindPredict
+	}
+	if m.YH != nil {
+		return KindUpdate
+	}
+	return KindSensor
+}
+
+// ValidationError reports a missing or malformed field of a message
+type ValidationError struct {
+	Field   string
+	Problem string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Problem
+}
+
+// Wire format, pointers distinguish absent fields from zeros
+type wireVec struct {
+	X *float32 `json:"x"`
+	Y *float32 `json:"y"`
+	Z *float32 `json:"z"`
+	W *float32 `json:"w"`
+}
+
+type wireState struct {
+	X  *float32 `json:"x"`
+	Y  *float32 `json:"y"`
+	Z  *float32 `json:"z"`
+	VX *float32 `json:"vx"`
+	VY *float32 `json:"vy"`
+	VZ *float32 `json:"vz"`
+	DT *float32 `json:"dt"`
+}
+
+type wireMessage struct {
+	Micros      *float64 `json:"micros"`
+	SensorInput *struct {
+		Quat  *wireVec `json:"quat"`
+		Accel *wireVec `json:"accel"`
+		OF    *wireVec `json:"of"`
+	} `json:"sensor_input"`
+	State *wireState `json:"state"`
+	P     []float32  `json:"P"`
+	F     []float32  `json:"f"`
+	K     []float32  `json:"K"`
+	YH    []float32  `json:"y-h"`
+
+	Ack    *uint32       `json:"ack"`
+	OK     *bool         `json:"ok"`
+	Error  string        `json:"error"`
+	Params *FilterParams `json:"params"`
+}
+
+// DecodeJSON parses and validates one JSON message
+func DecodeJSON(raw []byte) (*Message, error) {
+	var w wireMessage
+	if err := json.Unmarshal(raw, &w); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, &ValidationError{Field: typeErr.Field, Problem: "expected " + typeErr.Type.String()}
+		}
+		return nil, err
+	}
+	return w.validate()
+}
+
+func (w *wireMessage) validate() (*Message, error) {
+	m := new(Message)
+
+	if w.Micros != nil {
+		m.Micros = *w.Micros
+		m.HasMicros = true
+	}
+
+	if si := w.SensorInput; si != nil {
+		if si.Quat != nil {
+			if err := requireFloats("sensor_input.quat", []string{"x", "y", "z", "w"}, si.Quat.X, si.Quat.Y, si.Quat.Z, si.Quat.W); err != nil {
+				return nil, err
+			}
+			m.Quat = &math32.Quaternion{X: *si.Quat.X, Y: *si.Quat.Y, Z: *si.Quat.Z, W: *si.Quat.W}
+		}
+		if si.Accel != nil {
+			if err := requireFloats("sensor_input.accel", []string{"x", "y", "z"}, si.Accel.X, si.Accel.Y, si.Accel.Z); err != nil {
+				return nil, err
+			}
+			m.Accel = &math32.Vector3{X: *si.Accel.X, Y: *si.Accel.Y, Z: *si.Accel.Z}
+		}
+		if si.OF != nil {
+			if err := requireFloats("sensor_input.of", []string{"x", "y", "z"}, si.OF.X, si.OF.Y, si.OF.Z); err != nil {
+				return nil, err
+			}
+			m.OF = &math32.Vector3{X: *si.OF.X, Y: *si.OF.Y, Z: *si.OF.Z}
+		}
+	}
+
+	if st := w.State; st != nil {
+		if err := requireFloats("state", []string{"x", "y", "z", "vx", "vy", "vz", "dt"}, st.X, st.Y, st.Z, st.VX, st.VY, st.VZ, st.DT); err != nil {
+			return nil, err
+		}
+		if !m.HasMicros {
+			return nil, &ValidationError{Field: "micros", Problem: "missing, required with state"}
+		}
+		m.State = &State{X: *st.X, Y: *st.Y, Z: *st.Z, VX: *st.VX, VY: *st.VY, VZ: *st.VZ, DT: *st.DT}
+	}
+
+	if w.Ack != nil {
+		if w.OK == nil {
+			return nil, &ValidationError{Field: "ok", Problem: "missing, required with ack"}
+		}
+		if p := w.Params; p != nil {
+			if _, err := requireLen("params.Q", p.Q, 6); err != nil {
+				return nil, err
+			}
+			if _, err := requireLen("params.R", p.R, 3); err != nil {
+				return nil, err
+			}
+			if _, err := requireLen("params.P0", p.P0, 6); err != nil {
+				return nil, err
+			}
+		}
+		m.Ack = &Ack{ID: *w.Ack, OK: *w.OK, Error: w.Error, Params: w.Params}
+	}
+
+	var err error
+	if m.P, err = requireLen("P", w.P, 6*6); err != nil {
+		return nil, err
+	}
+	if m.F, err = requireLen("f", w.F, 6); err != nil {
+		return nil, err
+	}
+	if m.K, err = requireLen("K", w.K, 3*6); err != nil {
+		return nil, err
+	}
+	if m.YH, err = requireLen("y-h", w.YH, 3); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func requireFloats(prefix string, names []string, values ...*float32) error {
+	for i, v := range values {
+		if v == nil {
+			return &ValidationError{Field: prefix + "." + names[i], Problem: "missing"}
+		}
+	}
+	return nil
+}
+
+func requireLen(field string, values []float32, n int) ([]float32, error) {
+	if values != nil && len(values) != n {
+		return nil, &ValidationError{Field: field, Problem: fmt.Sprintf("has %d elements, expected %d", len(values), n)}
+	}
+	return values, nil
+}
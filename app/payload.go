@@ -0,0 +1,354 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Minimal CBOR (RFC 8949) and MessagePack decoders producing the generic
+// values encoding/json would, maps always get string keys.
+
+var errTruncated = errors.New("truncated payload")
+
+// Nesting limit, guards against hostile or corrupt input
+const maxDecodeDepth = 16
+
+func decodeCBOR(data []byte) (interface{}, error) {
+	d := &payloadDecoder{data: data}
+	v, err := d.cbor(0)
+	if err != nil {
+		return nil, fmt.Errorf("cbor: %w", err)
+	}
+	if _, ok := v.(cborBreak); ok {
+		return nil, errors.New("cbor: unexpected break")
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("cbor: %d trailing bytes", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+func decodeMsgPack(data []byte) (interface{}, error) {
+	d := &payloadDecoder{data: data}
+	v, err := d.msgpack(0)
+	if err != nil {
+		return nil, fmt.Errorf("msgpack: %w", err)
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("msgpack: %d trailing bytes", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+type payloadDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *payloadDecoder) take(n int) ([]byte, error) {
+	// Compared this way round, huge lengths would overflow d.pos+n
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads an n byte big-endian unsigned integer
+func (d *payloadDecoder) uint(n int) (uint64, error) {
+	b, err := d.take(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// cborBreak is returned for the 0xFF stop code of indefinite containers
+type cborBreak struct{}
+
+func (d *payloadDecoder) cbor(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.New("nesting too deep")
+	}
+	head, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	major, info := head[0]>>5, head[0]&0x1F
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			bits, err := d.uint(2)
+			if err != nil {
+				return nil, err
+			}
+			return halfToFloat(uint16(bits)), nil
+		case 26:
+			bits, err := d.uint(4)
+			if err != nil {
+				return nil, err
+			}
+			return float64(math.Float32frombits(uint32(bits))), nil
+		case 27:
+			bits, err := d.uint(8)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(bits), nil
+		case 31:
+			return cborBreak{}, nil
+		}
+		return nil, fmt.Errorf("unsupported simple value %d", info)
+	}
+
+	// Argument, indefinite length containers use -1
+	var arg uint64
+	indefinite := false
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		if arg, err = d.uint(1 << (info - 24)); err != nil {
+			return nil, err
+		}
+	case info == 31 && major >= 2 && major <= 5:
+		indefinite = true
+	default:
+		return nil, fmt.Errorf("invalid additional info %d", info)
+	}
+
+	switch major {
+	case 0:
+		return float64(arg), nil
+	case 1:
+		return -1 - float64(arg), nil
+	case 2, 3:
+		if indefinite {
+			var s []byte
+			for {
+				chunk, err := d.cbor(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := chunk.(cborBreak); ok {
+					return string(s), nil
+				}
+				str, ok := chunk.(string)
+				if !ok {
+					return nil, errors.New("bad string chunk")
+				}
+				s = append(s, str...)
+			}
+		}
+		b, err := d.take(int(arg))
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 4:
+		arr := []interface{}{}
+		for i := 0; indefinite || i < int(arg); i++ {
+			v, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := v.(cborBreak); ok {
+				if !indefinite {
+					return nil, errors.New("unexpected break")
+				}
+				break
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case 5:
+		obj := map[string]interface{}{}
+		for i := 0; indefinite || i < int(arg); i++ {
+			k, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := k.(cborBreak); ok {
+				if !indefinite {
+					return nil, errors.New("unexpected break")
+				}
+				break
+			}
+			v, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := v.(cborBreak); ok {
+				return nil, errors.New("map key without value")
+			}
+			obj[fmt.Sprint(k)] = v
+		}
+		return obj, nil
+	case 6:
+		// Tags carry no meaning for us, decode the tagged item
+		return d.cbor(depth + 1)
+	}
+	return nil, fmt.Errorf("unsupported major type %d", major)
+}
+
+// halfToFloat converts an IEEE 754 half precision value
+func halfToFloat(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1F
+	frac := float64(h & 0x3FF)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1F:
+		if frac == 0 {
+			return sign * math.Inf(1)
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(frac+1024, exp-25)
+}
+
+func (d *payloadDecoder) msgpack(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.New("nesting too deep")
+	}
+	head, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	b := head[0]
+
+	switch {
+	case b <= 0x7F:
+		return float64(b), nil
+	case b >= 0xE0:
+		return float64(int8(b)), nil
+	case b&0xF0 == 0x80:
+		return d.msgpackMap(depth, int(b&0x0F))
+	case b&0xF0 == 0x90:
+		return d.msgpackArray(depth, int(b&0x0F))
+	case b&0xE0 == 0xA0:
+		return d.msgpackString(int(b & 0x1F))
+	}
+
+	switch b {
+	case 0xC0:
+		return nil, nil
+	case 0xC2:
+		return false, nil
+	case 0xC3:
+		return true, nil
+	case 0xC4, 0xC5, 0xC6:
+		// bin 8/16/32
+		n, err := d.uint(1 << (b - 0xC4))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackString(int(n))
+	case 0xD9, 0xDA, 0xDB:
+		// str 8/16/32
+		n, err := d.uint(1 << (b - 0xD9))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackString(int(n))
+	case 0xCA:
+		bits, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(bits))), nil
+	case 0xCB:
+		bits, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(bits), nil
+	case 0xCC, 0xCD, 0xCE, 0xCF:
+		v, err := d.uint(1 << (b - 0xCC))
+		if err != nil {
+			return nil, err
+		}
+		return float64(v), nil
+	case 0xD0, 0xD1, 0xD2, 0xD3:
+		n := 1 << (b - 0xD0)
+		v, err := d.uint(n)
+		if err != nil {
+			return nil, err
+		}
+		// Sign extend
+		shift := 64 - 8*n
+		return float64(int64(v<<shift) >> shift), nil
+	case 0xDC, 0xDD:
+		n, err := d.uint(2 << (b - 0xDC))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackArray(depth, int(n))
+	case 0xDE, 0xDF:
+		n, err := d.uint(2 << (b - 0xDE))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackMap(depth, int(n))
+	}
+	return nil, fmt.Errorf("unsupported type byte 0x%02x", b)
+}
+
+func (d *payloadDecoder) msgpackString(n int) (interface{}, error) {
+	s, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(s), nil
+}
+
+func (d *payloadDecoder) msgpackArray(depth, n int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	arr := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func (d *payloadDecoder) msgpackMap(depth, n int) (interface{}, error) {
+	if 2*n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	obj := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		obj[fmt.Sprint(k)] = v
+	}
+	return obj, nil
+}
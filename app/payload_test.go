@@ -0,0 +1,69 @@
+package app
+
+import (
+	"errors"
+	"testing"
+)
+
+// {"micros": 1000, "sensor_input": {"accel": {"x": 1.5, "y": -2, "z": 0.25}}}
+// with x as a half float in CBOR and a float64 in MessagePack, z as float32
+const (
+	cborMessage = "\xa2\x66micros\x19\x03\xe8\x6csensor_input\xa1\x65accel\xa3" +
+		"\x61x\xf9\x3e\x00\x61y\x21\x61z\xfa\x3e\x80\x00\x00"
+	msgpackMessage = "\x82\xa6micros\xcd\x03\xe8\xacsensor_input\x81\xa5accel\x83" +
+		"\xa1x\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00\xa1y\xfe\xa1z\xca\x3e\x80\x00\x00"
+)
+
+func TestDecodePayloads(t *testing.T) {
+	cases := []struct {
+		format WireFormat
+		frame  string
+	}{
+		{FormatCBORLength, cborMessage},
+		{FormatCBORLines, cborMessage},
+		{FormatMsgPackLength, msgpackMessage},
+		{FormatMsgPackLines, msgpackMessage},
+	}
+	for _, c := range cases {
+		msg, err := c.format.Decode([]byte(c.frame))
+		if err != nil {
+			t.Errorf("%s: %v", c.format, err)
+			continue
+		}
+		if !msg.HasMicros || msg.Micros != 1000 {
+			t.Errorf("%s: micros %v", c.format, msg.Micros)
+		}
+		if a := msg.Accel; a == nil || a.X != 1.5 || a.Y != -2 || a.Z != 0.25 {
+			t.Errorf("%s: accel %+v", c.format, a)
+		}
+	}
+}
+
+func TestDecodeTruncatedPayloads(t *testing.T) {
+	for i := 1; i < len(cborMessage); i++ {
+		if _, err := decodeCBOR([]byte(cborMessage[:i])); !errors.Is(err, errTruncated) {
+			t.Errorf("cbor cut at %d: error %v", i, err)
+		}
+	}
+	for i := 1; i < len(msgpackMessage); i++ {
+		if _, err := decodeMsgPack([]byte(msgpackMessage[:i])); !errors.Is(err, errTruncated) {
+			t.Errorf("msgpack cut at %d: error %v", i, err)
+		}
+	}
+}
+
+func TestDecodeHugeLengths(t *testing.T) {
+	frames := []string{
+		"\x7b\x7f\xff\xff\xff\xff\xff\xff\xff", // text string of 2^63-1 bytes
+		"\x5b\xff\xff\xff\xff\xff\xff\xff\xff", // byte string of 2^64-1 bytes
+		"\x9b\x7f\xff\xff\xff\xff\xff\xff\xff", // array of 2^63-1 items
+	}
+	for _, f := range frames {
+		if _, err := decodeCBOR([]byte(f)); err == nil {
+			t.Errorf("% x decoded", f)
+		}
+	}
+	if _, err := decodeMsgPack([]byte("\xdb\xff\xff\xff\xff")); !errors.Is(err, errTruncated) {
+		t.Errorf("msgpack str32: error %v", err)
+	}
+}
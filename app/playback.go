@@ -0,0 +1,148 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/g3n/engine/gui"
+)
+
+// buildReplay adds the replay controls to the sidebar
+func (a *App) buildReplay() {
+	// Recording to replay
+	replay_hb := gui.NewHBoxLayout()
+	replay_hb.SetAlignH(gui.AlignLeft)
+	replay_hb.SetAutoWidth(false)
+	replay_hb.SetSpacing(5)
+	replay_p := gui.NewPanel(a.sidebar.Width(), 18)
+	replay_p.SetLayout(replay_hb)
+	a.sidebar.Add(replay_p)
+	replay_l := gui.NewLabel("Replay: ")
+	replay_p.Add(replay_l)
+	open_btn := gui.NewButton("Open")
+	a.replay_ed = gui.NewEdit(int(replay_p.Width()-replay_l.Width()-open_btn.Width()-18), "session, raw.jsonl or log.csv")
+	replay_p.Add(a.replay_ed)
+	open_btn.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		a.openReplay()
+	})
+	replay_p.Add(open_btn)
+	replay_p.SetHeight(open_btn.Height())
+
+	// Transport controls
+	ctl_hb := gui.NewHBoxLayout()
+	ctl_hb.SetAlignH(gui.AlignLeft)
+	ctl_hb.SetAutoWidth(false)
+	ctl_hb.SetSpacing(5)
+	ctl_p := gui.NewPanel(a.sidebar.Width(), 18)
+	ctl_p.SetLayout(ctl_hb)
+	a.sidebar.Add(ctl_p)
+	a.replay_play_btn = gui.NewButton("Pause")
+	a.replay_play_btn.Label.SetText("Play")
+	a.replay_play_btn.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		if a.replay == nil {
+			a.openReplay()
+			return
+		}
+		a.replay.SetPlaying(!a.replay.Playing())
+	})
+	ctl_p.Add(a.replay_play_btn)
+	step_btn := gui.NewButton("Step")
+	step_btn.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		if a.replay != nil {
+			a.replay.Step()
+		}
+	})
+	ctl_p.Add(step_btn)
+	ctl_p.Add(gui.NewLabel("Speed: "))
+	a.replay_speed_dd = gui.NewDropDown(64, gui.NewImageLabel(""))
+	for i, s := range replaySpeeds {
+		a.replay_speed_dd.Add(gui.NewImageLabel(fmt.Sprintf("%gx", s)))
+		if s == 1 {
+			a.replay_speed_dd.SelectPos(i)
+		}
+	}
+	a.replay_speed_dd.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if a.replay != nil {
+			a.replay.SetSpeed(a.replaySpeed())
+		}
+	})
+	ctl_p.Add(a.replay_speed_dd)
+	a.replay_loop_cb = gui.NewCheckBox("Loop")
+	a.replay_loop_cb.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if a.replay != nil {
+			a.replay.SetLoop(a.replay_loop_cb.Value())
+		}
+	})
+	ctl_p.Add(a.replay_loop_cb)
+	ctl_p.SetHeight(a.replay_play_btn.Height())
+
+	// Timeline scrubber
+	a.replay_sl = gui.NewHSlider(a.sidebar.Width()-10, replay_l.Height())
+	a.replay_sl.SetText("no replay")
+	a.replay_sl.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if a.replay_set || a.replay == nil {
+			return
+		}
+		_, length := a.replay.Position()
+		a.replay.Seek(float64(a.replay_sl.Value())*length, a.histWindow)
+	})
+	a.sidebar.Add(a.replay_sl)
+}
+
+// openReplay connects to the recording named in the replay edit
+func (a *App) openReplay() {
+	path := a.replay_ed.Text()
+	if path == "" {
+		return
+	}
+	a.replay = NewReplaySource(path)
+	a.replay.SetSpeed(a.replaySpeed())
+	a.replay.SetLoop(a.replay_loop_cb.Value())
+	a.con.Connect(a.replay)
+}
+
+func (a *App) replaySpeed() float64 {
+	if pos := a.replay_speed_dd.SelectedPos(); pos >= 0 {
+		return replaySpeeds[pos]
+	}
+	return 1
+}
+
+// updateReplay follows the playback position with the scrubber
+func (a *App) updateReplay() {
+	if a.replay != nil && !a.con.isActive(a.replay) {
+		// Disconnected or replaced by another source
+		a.replay = nil
+	}
+
+	playing := a.replay != nil && a.replay.Playing()
+	if playing != a.replay_playing {
+		a.replay_playing = playing
+		if playing {
+			a.replay_play_btn.Label.SetText("Pause")
+		} else {
+			a.replay_play_btn.Label.SetText("Play")
+		}
+	}
+
+	var pos, length float64
+	if a.replay != nil {
+		pos, length = a.replay.Position()
+	}
+	if pos == a.replay_pos && length == a.replay_len {
+		return
+	}
+	a.replay_pos, a.replay_len = pos, length
+	var v float32
+	if length > 0 {
+		v = float32(pos / length)
+	}
+	// SetValue dispatches OnChange, which would seek
+	a.replay_set = true
+	a.replay_sl.SetValue(v)
+	a.replay_set = false
+	if a.replay != nil {
+		a.replay_sl.SetText(fmt.Sprintf("%.1f / %.1f s", pos, length))
+	} else {
+		a.replay_sl.SetText("no replay")
+	}
+}
@@ -0,0 +1,504 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/g3n/engine/math32"
+)
+
+// Frames between keyframes of the recording index, a few seconds of
+// messages at the usual rates
+const replayKeyframeEvery = 500
+
+// Longest raw capture line, a frame with P, K and f is a few kB
+const replayMaxLine = 1 << 20
+
+// replayIndexFile keeps the index of a recording in its directory, it is
+// reused while the recording has the size it was indexed at
+const replayIndexFile = "index.json"
+
+// replayFrame is one recorded frame on the recording's own timeline
+type replayFrame struct {
+	t      float64 // device seconds since the first frame, never decreasing
+	data   []byte
+	format WireFormat
+}
+
+// replayCursor is a read position in a recording, with what is needed to
+// carry on timing the frames from there
+type replayCursor struct {
+	offset int64 // of the next record
+	frame  int   // frames before offset
+	clock  deviceClock
+	t      float64 // time of the last frame before offset
+}
+
+// replayState is the filter state restored when playback jumps to a
+// keyframe, the messages after it fill in the rest
+type replayState struct {
+	x    [6]float32
+	P    [6 * 6]float32
+	quat math32.Quaternion // as received, in the device frame
+}
+
+func (s *replayState) update(msg *Message) {
+	if st := msg.State; st != nil {
+		s.x = [6]float32{st.X, st.Y, st.Z, st.VX, st.VY, st.VZ}
+	}
+	if msg.P != nil {
+		copy(s.P[:], msg.P)
+	}
+	if msg.Quat != nil {
+		s.quat = *msg.Quat
+	}
+}
+
+// replayKeyframe is an entry of the recording index
+type replayKeyframe struct {
+	cur   replayCursor
+	state replayState // after the frames before cur
+}
+
+// recording reads the frames of a raw capture or a CSV log from any
+// keyframe. The CSV lacks f, K and y-h so its rows replay as sensor
+// messages.
+type recording struct {
+	f       *os.File
+	csv     bool
+	col     map[string]int // CSV column per name
+	first   float64        // device time of the first frame with micros, seconds
+	length  float64        // seconds
+	frames  int
+	index   []replayKeyframe
+	skipped int // unreadable records
+
+	cur  replayCursor
+	rd   *bufio.Reader
+	cr   *csv.Reader
+	base int64 // offset the CSV reader started at
+}
+
+// resolveReplayPath picks the file to replay, preferring the raw capture
+// of a session directory over its CSV log
+func resolveReplayPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && filepath.Base(path) == path {
+		path = filepath.Join(logRoot, path)
+		info, err = os.Stat(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+	for _, name := range []string{sessionRawFile, sessionLogFile} {
+		if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+			return filepath.Join(path, name), nil
+		}
+	}
+	return "", fmt.Errorf("no %s or %s in %s", sessionRawFile, sessionLogFile, path)
+}
+
+// openRecording loads the saved index, or reads through the whole file
+// once to build and save it
+func openRecording(path string) (*recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rc := &recording{f: f, csv: strings.EqualFold(filepath.Ext(path), ".csv"), first: -1}
+	if err := rc.loadIndex(path); err != nil {
+		if err := rc.buildIndex(); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rc.saveIndex(path)
+	}
+	if rc.frames == 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s: no frames", path)
+	}
+	if rc.skipped > 0 {
+		fmt.Printf("Skipped %d unreadable records in %s\n", rc.skipped, path)
+	}
+	return rc, rc.seek(rc.index[0].cur)
+}
+
+func (rc *recording) buildIndex() error {
+	start := replayCursor{}
+	if rc.csv {
+		if err := rc.readHeader(); err != nil {
+			return err
+		}
+		start.offset = rc.base + rc.cr.InputOffset()
+	}
+	if err := rc.seek(start); err != nil {
+		return err
+	}
+
+	var state replayState
+	for {
+		if rc.cur.frame%replayKeyframeEvery == 0 {
+			rc.index = append(rc.index, replayKeyframe{cur: rc.cur, state: state})
+		}
+		frame, msg, err := rc.next()
+		if err != nil {
+			return err
+		}
+		if frame == nil {
+			break
+		}
+		if msg != nil {
+			state.update(msg)
+		}
+	}
+	rc.length = rc.cur.t
+	rc.frames = rc.cur.frame
+	return nil
+}
+
+// savedIndex is the form of the index kept in replayIndexFile
+type savedIndex struct {
+	File      string          `json:"file"`
+	Size      int64           `json:"size"`
+	First     float64         `json:"first"`
+	Length    float64         `json:"length"`
+	Frames    int             `json:"frames"`
+	Skipped   int             `json:"skipped"`
+	Keyframes []savedKeyframe `json:"keyframes"`
+}
+
+type savedKeyframe struct {
+	Offset int64 `json:"offset"`
+	Frame  int   `json:"frame"`
+	// deviceClock
+	ClockOffset  float64 `json:"clock_offset"`
+	ClockLastRaw float64 `json:"clock_last_raw"`
+	ClockLast    float64 `json:"clock_last"`
+	ClockSeen    bool    `json:"clock_seen"`
+	T            float64 `json:"t"`
+	// replayState
+	X    [6]float32     `json:"x"`
+	P    [6 * 6]float32 `json:"P"`
+	Quat [4]float32     `json:"quat"`
+}
+
+// loadIndex reads the saved index of path, failing when there is none or
+// it was built for another file or size
+func (rc *recording) loadIndex(path string) error {
+	info, err := rc.f.Stat()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), replayIndexFile))
+	if err != nil {
+		return err
+	}
+	var saved savedIndex
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	if saved.File != filepath.Base(path) || saved.Size != info.Size() || len(saved.Keyframes) == 0 {
+		return errors.New("index is out of date")
+	}
+	if rc.csv {
+		if err := rc.readHeader(); err != nil {
+			return err
+		}
+	}
+
+	rc.first, rc.length = saved.First, saved.Length
+	rc.frames, rc.skipped = saved.Frames, saved.Skipped
+	rc.index = make([]replayKeyframe, len(saved.Keyframes))
+	for i, k := range saved.Keyframes {
+		rc.index[i] = replayKeyframe{
+			cur: replayCursor{
+				offset: k.Offset,
+				frame:  k.Frame,
+				clock:  deviceClock{offset: k.ClockOffset, lastRaw: k.ClockLastRaw, last: k.ClockLast, seen: k.ClockSeen},
+				t:      k.T,
+			},
+			state: replayState{
+				x:    k.X,
+				P:    k.P,
+				quat: math32.Quaternion{X: k.Quat[0], Y: k.Quat[1], Z: k.Quat[2], W: k.Quat[3]},
+			},
+		}
+	}
+	return nil
+}
+
+// saveIndex writes the index next to path, a recording still being
+// written will not match it next time and is indexed again
+func (rc *recording) saveIndex(path string) {
+	info, err := rc.f.Stat()
+	if err != nil {
+		fmt.Println("Error saving replay index:", err)
+		return
+	}
+	saved := savedIndex{
+		File:      filepath.Base(path),
+		Size:      info.Size(),
+		First:     rc.first,
+		Length:    rc.length,
+		Frames:    rc.frames,
+		Skipped:   rc.skipped,
+		Keyframes: make([]savedKeyframe, len(rc.index)),
+	}
+	for i, k := range rc.index {
+		c, s := k.cur, k.state
+		saved.Keyframes[i] = savedKeyframe{
+			Offset:       c.offset,
+			Frame:        c.frame,
+			ClockOffset:  c.clock.offset,
+			ClockLastRaw: c.clock.lastRaw,
+			ClockLast:    c.clock.last,
+			ClockSeen:    c.clock.seen,
+			T:            c.t,
+			X:            s.x,
+			P:            s.P,
+			Quat:         [4]float32{s.quat.X, s.quat.Y, s.quat.Z, s.quat.W},
+		}
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		fmt.Println("Error encoding replay index:", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), replayIndexFile), data, 0644); err != nil {
+		fmt.Println("Error saving replay index:", err)
+	}
+}
+
+func (rc *recording) readHeader() error {
+	rc.rd = bufio.NewReader(rc.f)
+	rc.cr = csv.NewReader(rc.rd)
+	rc.cr.FieldsPerRecord = -1
+	header, err := rc.cr.Read()
+	if err != nil {
+		return err
+	}
+	rc.col = make(map[string]int, len(header))
+	for i, name := range header {
+		rc.col[name] = i
+	}
+	if _, ok := rc.col["t"]; !ok {
+		return errors.New("not a log file, no t column")
+	}
+	return nil
+}
+
+// seek moves the read position to cur
+func (rc *recording) seek(cur replayCursor) error {
+	if _, err := rc.f.Seek(cur.offset, io.SeekStart); err != nil {
+		return err
+	}
+	rc.cur = cur
+	rc.rd = bufio.NewReaderSize(rc.f, 64*1024)
+	if rc.csv {
+		rc.cr = csv.NewReader(rc.rd)
+		rc.cr.FieldsPerRecord = -1
+		rc.base = cur.offset
+	}
+	return nil
+}
+
+// keyframeBefore returns the index of the last keyframe at or before t
+func (rc *recording) keyframeBefore(t float64) int {
+	k := sort.Search(len(rc.index), func(i int) bool {
+		return rc.index[i].cur.t > t
+	})
+	return max(k-1, 0)
+}
+
+// next reads the frame at the read position, nil at the end. The message
+// is nil when the frame does not decode, it keeps the previous time.
+func (rc *recording) next() (*replayFrame, *Message, error) {
+	var frame *replayFrame
+	var err error
+	if rc.csv {
+		frame, err = rc.nextCSV()
+	} else {
+		frame, err = rc.nextRaw()
+	}
+	if frame == nil || err != nil {
+		return nil, nil, err
+	}
+	rc.cur.frame++
+
+	msg, err := frame.format.Decode(frame.data)
+	if err != nil {
+		msg = nil
+	} else if msg.HasMicros {
+		t := rc.cur.clock.unwrap(msg.Micros) / 1e6
+		if rc.first < 0 {
+			rc.first = t
+		}
+		rc.cur.t = max(rc.cur.t, t-rc.first)
+	}
+	frame.t = rc.cur.t
+	return frame, msg, nil
+}
+
+func (rc *recording) nextRaw() (*replayFrame, error) {
+	for {
+		line, err := rc.rd.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Longer than the buffer, gather the rest of the line
+			long := append([]byte(nil), line...)
+			for err == bufio.ErrBufferFull && len(long) < replayMaxLine {
+				line, err = rc.rd.ReadSlice('\n')
+				long = append(long, line...)
+			}
+			line = long
+		}
+		rc.cur.offset += int64(len(line))
+		if err == bufio.ErrBufferFull {
+			// Too long to be a frame, skip to the end of the line
+			for err == bufio.ErrBufferFull {
+				line, err = rc.rd.ReadSlice('\n')
+				rc.cur.offset += int64(len(line))
+			}
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			rc.skipped++
+			if err == io.EOF {
+				return nil, nil
+			}
+			continue
+		}
+		if err == io.EOF && len(line) == 0 {
+			return nil, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec rawRecord
+		if json.Unmarshal(line, &rec) != nil {
+			// Also the last line of a capture cut short by a crash
+			rc.skipped++
+			continue
+		}
+		data, derr := rec.Bytes()
+		format, ok := parseWireFormat(rec.Format)
+		if derr != nil || !ok {
+			rc.skipped++
+			continue
+		}
+		return &replayFrame{data: data, format: format}, nil
+	}
+}
+
+// nextCSV turns the next data row back into a JSON message, skipping
+// event rows
+func (rc *recording) nextCSV() (*replayFrame, error) {
+	for {
+		row, err := rc.cr.Read()
+		rc.cur.offset = rc.base + rc.cr.InputOffset()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rc.skipped++
+				continue
+			}
+			return nil, err
+		}
+		if i, ok := rc.col["event"]; ok && i < len(row) && row[i] != "" {
+			continue
+		}
+		data, err := csvMessage(row, rc.col)
+		if err != nil {
+			rc.skipped++
+			continue
+		}
+		return &replayFrame{data: data, format: FormatJSON}, nil
+	}
+}
+
+func (rc *recording) close() {
+	rc.f.Close()
+}
+
+// csvMessage re-encodes one log row as a JSON message. Empty columns are
+// absent fields.
+func csvMessage(row []string, col map[string]int) ([]byte, error) {
+	field := func(name string) string {
+		if i, ok := col[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	object := func(prefix string, keys ...string) map[string]json.Number {
+		if field(prefix+keys[0]) == "" {
+			return nil
+		}
+		obj := make(map[string]json.Number, len(keys))
+		for _, k := range keys {
+			obj[k] = json.Number(field(prefix + k))
+		}
+		return obj
+	}
+
+	t, err := strconv.ParseFloat(field("t"), 64)
+	if err != nil {
+		return nil, err
+	}
+	msg := map[string]interface{}{"micros": json.Number(strconv.FormatFloat(t*1e6, 'f', -1, 64))}
+	sensor := map[string]interface{}{}
+	if quat := object("quat_", "x", "y", "z", "w"); quat != nil {
+		sensor["quat"] = quat
+	}
+	if accel := object("accel_", "x", "y", "z"); accel != nil {
+		sensor["accel"] = accel
+	}
+	if of := object("of_", "x", "y", "z"); of != nil {
+		sensor["of"] = of
+	}
+	if len(sensor) > 0 {
+		msg["sensor_input"] = sensor
+	}
+	if state := object("x_", "x", "y", "z", "vx", "vy", "vz"); state != nil {
+		state["dt"] = json.Number(field("dt"))
+		msg["state"] = state
+	}
+	if field("P_0") != "" {
+		P := make([]json.Number, 6*6)
+		for i := range P {
+			P[i] = json.Number(field(fmt.Sprintf("P_%d", i)))
+		}
+		msg["P"] = P
+	}
+	// Invalid numbers fail here
+	return json.Marshal(msg)
+}
+
+// parseWireFormat looks a format up by the name it is shown and recorded with
+func parseWireFormat(name string) (WireFormat, bool) {
+	for i, n := range wireFormatNames {
+		if n == name {
+			return WireFormat(i), true
+		}
+	}
+	return FormatAuto, false
+}
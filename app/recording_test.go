@@ -0,0 +1,99 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeCapture records frames JSON messages 20 ms apart as a raw capture
+func writeCapture(t *testing.T, path string, frames int) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for i := 0; i < frames; i++ {
+		msg := fmt.Sprintf(`{"micros": %d, "state": {"x": %d, "y": 0, "z": 0, "vx": 0, "vy": 0, "vz": 0, "dt": 0}}`, i*20000, i)
+		if err := enc.Encode(newRawRecord(time.Now(), []byte(msg), FormatJSON)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecordingIndexReuse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sessionRawFile)
+	writeCapture(t, path, 3*replayKeyframeEvery+10)
+
+	built, err := openRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	built.close()
+	if len(built.index) != 4 {
+		t.Fatalf("%d keyframes, want 4", len(built.index))
+	}
+
+	loaded := &recording{first: -1}
+	if loaded.f, err = os.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.close()
+	if err := loaded.loadIndex(path); err != nil {
+		t.Fatal("saved index not reused:", err)
+	}
+	if !reflect.DeepEqual(loaded.index, built.index) || loaded.length != built.length || loaded.frames != built.frames {
+		t.Error("loaded index differs from the built one")
+	}
+
+	// Seeking through the loaded index carries on the timeline
+	k := loaded.keyframeBefore(built.length)
+	if err := loaded.seek(loaded.index[k].cur); err != nil {
+		t.Fatal(err)
+	}
+	frame, _, err := loaded.next()
+	if err != nil || frame == nil || frame.t != float64(k*replayKeyframeEvery)*0.02 {
+		t.Errorf("frame after keyframe %d: %+v, %v", k, frame, err)
+	}
+
+	// A capture that grew is indexed again
+	writeCapture(t, path, 3*replayKeyframeEvery+20)
+	stale := &recording{first: -1}
+	if stale.f, err = os.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer stale.close()
+	if err := stale.loadIndex(path); err == nil {
+		t.Error("index reused after the capture changed size")
+	}
+}
+
+func TestRecordingSkipsLongLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sessionRawFile)
+	writeCapture(t, path, 10)
+	frames, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := append(bytes.Repeat([]byte{'-'}, 2*replayMaxLine), '\n')
+	data := append(append(append([]byte(nil), frames...), long...), frames...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := openRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.close()
+	if rc.frames != 20 || rc.skipped != 1 {
+		t.Errorf("%d frames, %d skipped, want 20 and 1", rc.frames, rc.skipped)
+	}
+}
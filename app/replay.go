@@ -0,0 +1,311 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Replay speeds offered in the GUI
+var replaySpeeds = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10}
+
+// replayRewind is returned by ReplaySource.ReadFrame when playback jumps
+// to a keyframe, the connector clears the filter state and restores the
+// keyframe's before carrying on
+type replayRewind struct {
+	state replayState
+}
+
+func (e *replayRewind) Error() string {
+	return "replay rewound"
+}
+
+// ReplaySource plays a recorded session back through the connector with
+// the original timing, reading a raw capture (sessionRawFile) or the CSV
+// log as it goes. Seeking starts from the keyframe before the target's
+// history window, so long recordings are not read from the start.
+//
+// Playback is controlled from the GUI while the read goroutine blocks in
+// ReadFrame, both sides meet under mu and wake is signalled on changes.
+type ReplaySource struct {
+	path string
+
+	mu      sync.Mutex
+	rec     *recording // nil until opened
+	wake    chan struct{}
+	closed  chan struct{}
+	once    sync.Once
+	format  WireFormat   // of the frame last returned
+	pending *replayFrame // read but not yet due
+	ended   bool
+	pos     float64 // time of the frame last returned
+	playing bool
+	speed   float64
+	loop    bool
+	step    bool    // release one frame while paused
+	seek    float64 // pending seek target, negative for none
+	window  float64 // seconds of history rebuilt before a seek target
+	fast    float64 // frames up to here are released without waiting
+	rewind  *replayState
+	base    time.Time // wall clock time at which baseT is due
+	baseT   float64
+}
+
+// NewReplaySource replays path, a session directory (by name under logRoot
+// or as a path), a raw capture or a CSV log
+func NewReplaySource(path string) *ReplaySource {
+	return &ReplaySource{
+		path:   path,
+		wake:   make(chan struct{}, 1),
+		closed: make(chan struct{}),
+		speed:  1,
+		seek:   -1,
+		fast:   -1,
+	}
+}
+
+// Open indexes the recording
+func (r *ReplaySource) Open() error {
+	path, err := resolveReplayPath(r.path)
+	if err != nil {
+		return err
+	}
+	rec, err := openRecording(path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.closed:
+		rec.close()
+		return io.EOF
+	default:
+	}
+	r.rec = rec
+	r.playing = true
+	r.jump(0) // start from a clean scene
+	r.resync()
+	return nil
+}
+
+// jump moves the read position to keyframe k, the caller holds mu
+func (r *ReplaySource) jump(k int) {
+	kf := &r.rec.index[k]
+	if err := r.rec.seek(kf.cur); err != nil {
+		fmt.Println("Error seeking replay:", err)
+	}
+	r.pending = nil
+	r.ended = false
+	state := kf.state
+	r.rewind = &state
+}
+
+// resync restarts the wall clock from the current position, the caller
+// holds mu
+func (r *ReplaySource) resync() {
+	r.base = time.Now()
+	r.baseT = r.pos
+}
+
+// signal wakes ReadFrame after a control change
+func (r *ReplaySource) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ReadFrame blocks until the next frame is due. Jumping to a keyframe
+// returns a *replayRewind, the end of the recording pauses unless looping.
+func (r *ReplaySource) ReadFrame() ([]byte, error) {
+	for {
+		r.mu.Lock()
+		select {
+		case <-r.closed:
+			r.mu.Unlock()
+			return nil, io.EOF
+		default:
+		}
+		if r.seek >= 0 {
+			r.seekTo(r.seek)
+			r.seek = -1
+		}
+		if r.rewind != nil {
+			rewind := &replayRewind{state: *r.rewind}
+			r.rewind = nil
+			r.mu.Unlock()
+			return nil, rewind
+		}
+		if r.pending == nil && !r.ended {
+			frame, _, err := r.rec.next()
+			if err != nil {
+				fmt.Println("Error reading replay:", err)
+			}
+			r.pending = frame
+			r.ended = frame == nil
+		}
+		if r.ended {
+			if r.loop && r.playing {
+				r.jump(0)
+				r.pos, r.fast = 0, -1
+				r.resync()
+				r.mu.Unlock()
+				continue
+			}
+			r.playing = false
+			r.mu.Unlock()
+			if !r.wait(nil) {
+				return nil, io.EOF
+			}
+			continue
+		}
+
+		f := r.pending
+		var delay time.Duration
+		switch {
+		case f.t <= r.fast || r.step:
+			r.step = false
+		case !r.playing:
+			r.mu.Unlock()
+			if !r.wait(nil) {
+				return nil, io.EOF
+			}
+			continue
+		default:
+			due := r.base.Add(time.Duration((f.t - r.baseT) / r.speed * float64(time.Second)))
+			delay = time.Until(due)
+		}
+		if delay > 0 {
+			r.mu.Unlock()
+			timer := time.NewTimer(delay)
+			ok := r.wait(timer.C)
+			timer.Stop()
+			if !ok {
+				return nil, io.EOF
+			}
+			continue
+		}
+		r.pending = nil
+		r.pos = f.t
+		r.format = f.format
+		r.mu.Unlock()
+		return f.data, nil
+	}
+}
+
+// seekTo plays on from the closest keyframe unless the frames up to t
+// follow on from the current position, the caller holds mu
+func (r *ReplaySource) seekTo(t float64) {
+	k := r.rec.keyframeBefore(t - r.window)
+	if t < r.pos || r.rec.index[k].cur.t > r.pos {
+		r.jump(k)
+	}
+	r.fast, r.pos = t, t
+	r.resync()
+}
+
+// wait blocks until a control change, the timer, or Close, reporting
+// false once closed
+func (r *ReplaySource) wait(timer <-chan time.Time) bool {
+	select {
+	case <-r.wake:
+	case <-timer:
+	case <-r.closed:
+		return false
+	}
+	return true
+}
+
+func (r *ReplaySource) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rec != nil {
+		r.rec.close()
+	}
+	return nil
+}
+
+func (r *ReplaySource) Describe() string {
+	return "replay " + r.path
+}
+
+// Format is the format of the frame last returned by ReadFrame, captures
+// can mix formats across reconnections
+func (r *ReplaySource) Format() WireFormat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.format
+}
+
+// SetPlaying starts or pauses playback, playing at the end starts over
+func (r *ReplaySource) SetPlaying(playing bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if playing && r.ended {
+		r.seek = 0
+	}
+	r.playing = playing
+	r.resync()
+	r.signal()
+}
+
+// Playing reports whether playback is running
+func (r *ReplaySource) Playing() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.playing
+}
+
+// Step releases the next frame while paused
+func (r *ReplaySource) Step() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.playing {
+		return
+	}
+	r.step = true
+	r.signal()
+}
+
+func (r *ReplaySource) SetSpeed(speed float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.speed = speed
+	r.resync()
+	r.signal()
+}
+
+func (r *ReplaySource) SetLoop(loop bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loop = loop
+	r.signal()
+}
+
+// Seek moves playback to t seconds into the recording. The frames of the
+// window before t are replayed at once, so the trail and history match.
+func (r *ReplaySource) Seek(t, window float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rec == nil {
+		return
+	}
+	r.seek = max(t, 0)
+	r.window = window
+	r.signal()
+}
+
+// Position returns the time of the last frame played and the length of
+// the recording, in seconds, both zero until loaded
+func (r *ReplaySource) Position() (pos, length float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rec == nil {
+		return 0, 0
+	}
+	return r.pos, r.rec.length
+}
@@ -0,0 +1,327 @@
+package app
+
+import (
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/geometry"
+	"github.com/g3n/engine/gls"
+	"github.com/g3n/engine/graphic"
+	"github.com/g3n/engine/material"
+	"github.com/g3n/engine/math32"
+	"github.com/g3n/engine/renderer/shaders"
+)
+
+// Points per ribbon segment. Only the newest segment's VBO is uploaded
+// again when points are added, the older ones stay on the GPU untouched.
+const ribbonChunk = 4096
+
+// Floats per vertex: position, direction, colour, time and side
+const ribbonStride = 3 + 3 + 3 + 1 + 1
+
+const ribbonVertexShader = `
+in vec3 VertexPosition;
+in vec3 VertexDir;
+in vec3 VertexColor;
+in float VertexTime;
+in float VertexSide;
+
+uniform mat4 MV;
+uniform mat4 Proj;
+uniform float Now;
+uniform float Window;
+uniform float Width;
+uniform float Opacity;
+uniform int Fade;
+
+out vec4 Color;
+
+void main() {
+    // Widen the line sideways, facing the camera
+    vec4 pos = MV * vec4(VertexPosition, 1.0);
+    vec3 side = cross(mat3(MV) * VertexDir, pos.xyz);
+    if (length(side) > 1e-6) {
+        pos.xyz += normalize(side) * VertexSide * Width * 0.5;
+    }
+
+    float alpha = Opacity;
+    if (Fade != 0 && Window > 0.0) {
+        alpha *= clamp(1.0 - (Now - VertexTime) / Window, 0.0, 1.0);
+    }
+    Color = vec4(VertexColor, alpha);
+    gl_Position = Proj * pos;
+}
+`
+
+const ribbonFragmentShader = `
+precision highp float;
+
+in vec4 Color;
+out vec4 FragColor;
+
+void main() {
+    if (Color.a <= 0.0) {
+        discard;
+    }
+    FragColor = Color;
+}
+`
+
+func init() {
+	shaders.AddShader("ribbonVertex", ribbonVertexShader)
+	shaders.AddShader("ribbonFragment", ribbonFragmentShader)
+	shaders.AddProgram("ribbon", "ribbonVertex", "ribbonFragment")
+}
+
+// Ribbon is a camera facing strip through a growing list of timed points,
+// drawn as a few triangle strip segments instead of one object per point.
+// Points older than the window are skipped, and faded out with age when
+// fading is on.
+type Ribbon struct {
+	core.Node
+	mat  *material.Material
+	segs []*ribbonSeg // oldest first
+	free []*ribbonSeg
+
+	maxPoints int
+	points    int     // stored in segs
+	base      float64 // time of VertexTime 0, keeps float32 precision
+	now       float64
+	window    float64
+
+	width   float32
+	opacity float32
+	fade    bool
+}
+
+// ribbonSeg is one triangle strip of up to ribbonChunk points, two
+// vertices per point. Each segment starts with a copy of the previous
+// segment's last point so the strip stays continuous.
+type ribbonSeg struct {
+	graphic.Graphic
+	ribbon *Ribbon
+	vbo    *gls.VBO
+	buf    math32.ArrayF32
+	times  []float64
+	start  int // first point within the window
+	drawn  [2]int
+
+	uniMV      gls.Uniform
+	uniProj    gls.Uniform
+	uniNow     gls.Uniform
+	uniWindow  gls.Uniform
+	uniWidth   gls.Uniform
+	uniOpacity gls.Uniform
+	uniFade    gls.Uniform
+}
+
+func NewRibbon(maxPoints int, width, opacity float32) *Ribbon {
+	r := new(Ribbon)
+	r.Node.Init(r)
+	r.mat = material.NewMaterial()
+	r.mat.SetShader("ribbon")
+	r.mat.SetTransparent(true)
+	r.mat.SetDepthMask(false)
+	r.mat.SetSide(material.SideDouble)
+	r.maxPoints = maxPoints
+	r.width = width
+	r.opacity = opacity
+	r.fade = true
+	return r
+}
+
+func (r *Ribbon) newSeg() *ribbonSeg {
+	if n := len(r.free); n > 0 {
+		s := r.free[n-1]
+		r.free = r.free[:n-1]
+		s.buf = s.buf[:0]
+		s.times = s.times[:0]
+		s.start = 0
+		s.drawn = [2]int{}
+		s.ClearMaterials()
+		s.vbo.SetBuffer(s.buf)
+		return s
+	}
+
+	s := &ribbonSeg{ribbon: r}
+	s.buf = make(math32.ArrayF32, 0, 2*ribbonChunk*ribbonStride)
+	s.times = make([]float64, 0, ribbonChunk)
+	s.vbo = gls.NewVBO(s.buf).
+		AddCustomAttrib("VertexPosition", 3).
+		AddCustomAttrib("VertexDir", 3).
+		AddCustomAttrib("VertexColor", 3).
+		AddCustomAttrib("VertexTime", 1).
+		AddCustomAttrib("VertexSide", 1)
+	s.vbo.SetUsage(gls.DYNAMIC_DRAW)
+	geom := geometry.NewGeometry()
+	geom.AddVBO(s.vbo)
+	s.Graphic.Init(s, geom, gls.TRIANGLE_STRIP)
+	// The bounding box is not kept up to date as points are added
+	s.SetCullable(false)
+	s.uniMV.Init("MV")
+	s.uniProj.Init("Proj")
+	s.uniNow.Init("Now")
+	s.uniWindow.Init("Window")
+	s.uniWidth.Init("Width")
+	s.uniOpacity.Init("Opacity")
+	s.uniFade.Init("Fade")
+	return s
+}
+
+// RenderSetup is called by the engine before drawing the segment
+func (s *ribbonSeg) RenderSetup(gs *gls.GLS, rinfo *core.RenderInfo) {
+	r := s.ribbon
+	mv := s.ModelViewMatrix()
+	gs.UniformMatrix4fv(s.uniMV.Location(gs), 1, false, &mv[0])
+	gs.UniformMatrix4fv(s.uniProj.Location(gs), 1, false, &rinfo.ProjMatrix[0])
+	gs.Uniform1f(s.uniNow.Location(gs), float32(r.now-r.base))
+	gs.Uniform1f(s.uniWindow.Location(gs), float32(r.window))
+	gs.Uniform1f(s.uniWidth.Location(gs), r.width)
+	gs.Uniform1f(s.uniOpacity.Location(gs), r.opacity)
+	fade := int32(0)
+	if r.fade {
+		fade = 1
+	}
+	gs.Uniform1i(s.uniFade.Location(gs), fade)
+}
+
+func (s *ribbonSeg) len() int {
+	return len(s.times)
+}
+
+func (s *ribbonSeg) pos(i int) math32.Vector3 {
+	o := 2 * i * ribbonStride
+	return math32.Vector3{X: s.buf[o], Y: s.buf[o+1], Z: s.buf[o+2]}
+}
+
+func (s *ribbonSeg) setDir(i int, dir *math32.Vector3) {
+	for v := 0; v < 2; v++ {
+		o := (2*i+v)*ribbonStride + 3
+		s.buf[o], s.buf[o+1], s.buf[o+2] = dir.X, dir.Y, dir.Z
+	}
+	s.vbo.Update()
+}
+
+func (s *ribbonSeg) add(pos, dir *math32.Vector3, c *math32.Color, t float64) {
+	vt := float32(t - s.ribbon.base)
+	for _, side := range []float32{-1, 1} {
+		s.buf = append(s.buf, pos.X, pos.Y, pos.Z, dir.X, dir.Y, dir.Z, c.R, c.G, c.B, vt, side)
+	}
+	s.times = append(s.times, t)
+	s.vbo.SetBuffer(s.buf)
+}
+
+// updateDraw draws the points from start on, if that changed
+func (s *ribbonSeg) updateDraw() {
+	drawn := [2]int{2 * s.start, 2 * (s.len() - s.start)}
+	if drawn == s.drawn {
+		return
+	}
+	s.drawn = drawn
+	s.ClearMaterials()
+	if drawn[1] >= 4 {
+		s.AddMaterial(s, s.ribbon.mat, drawn[0], drawn[1])
+	}
+}
+
+// Add appends a point at device time t, times must not decrease
+func (r *Ribbon) Add(pos math32.Vector3, t float64, c math32.Color) {
+	if len(r.segs) == 0 {
+		r.base = t
+		s := r.newSeg()
+		r.segs = append(r.segs, s)
+		r.Node.Add(s)
+	}
+	tail := r.segs[len(r.segs)-1]
+
+	if tail.len() == ribbonChunk {
+		// Continue the strip in a new segment from the last point
+		last := tail.len() - 1
+		lpos := tail.pos(last)
+		o := 2*last*ribbonStride + 3
+		ldir := math32.Vector3{X: tail.buf[o], Y: tail.buf[o+1], Z: tail.buf[o+2]}
+		lc := math32.Color{R: tail.buf[o+3], G: tail.buf[o+4], B: tail.buf[o+5]}
+		s := r.newSeg()
+		s.add(&lpos, &ldir, &lc, tail.times[last])
+		r.segs = append(r.segs, s)
+		r.Node.Add(s)
+		tail = s
+	}
+
+	// Point the previous point along the path through it
+	n := tail.len()
+	dir := math32.Vector3{X: 1}
+	if n > 0 {
+		prev := tail.pos(n - 1)
+		dir = *pos.Clone().Sub(&prev)
+		before := prev
+		if n > 1 {
+			before = tail.pos(n - 2)
+		} else if len(r.segs) > 1 {
+			// The first point copies the previous segment's last one
+			ps := r.segs[len(r.segs)-2]
+			if ps.len() > 1 {
+				before = ps.pos(ps.len() - 2)
+			}
+		}
+		through := *pos.Clone().Sub(&before)
+		tail.setDir(n-1, &through)
+		if n == 1 && len(r.segs) > 1 {
+			ps := r.segs[len(r.segs)-2]
+			ps.setDir(ps.len()-1, &through)
+		}
+	}
+	tail.add(&pos, &dir, &c, t)
+	r.points++
+
+	// Drop the oldest segment once over capacity
+	if r.points > r.maxPoints && len(r.segs) > 1 {
+		r.dropOldest()
+	}
+}
+
+// SetWindow sets the device time now and the window of points to draw
+func (r *Ribbon) SetWindow(now, window float64) {
+	r.now = now
+	r.window = window
+	for len(r.segs) > 0 {
+		s := r.segs[0]
+		for s.start < s.len() && now-s.times[s.start] > window {
+			s.start++
+		}
+		if s.start < s.len() || len(r.segs) == 1 {
+			break
+		}
+		r.dropOldest()
+	}
+	for _, s := range r.segs {
+		s.updateDraw()
+	}
+}
+
+func (r *Ribbon) dropOldest() {
+	s := r.segs[0]
+	r.segs = r.segs[1:]
+	r.Node.Remove(s)
+	n := s.len()
+	if len(r.segs) > 0 {
+		// The next segment's copy of our last point is no longer shared
+		n--
+	}
+	r.points -= n
+	r.free = append(r.free, s)
+}
+
+// Clear removes every point
+func (r *Ribbon) Clear() {
+	for len(r.segs) > 0 {
+		r.dropOldest()
+	}
+	r.points = 0
+}
+
+func (r *Ribbon) SetWidth(width float32) {
+	r.width = width
+}
+
+func (r *Ribbon) SetFade(fade bool) {
+	r.fade = fade
+}
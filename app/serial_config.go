@@ -0,0 +1,162 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+// File holding the serial settings, remembered between runs
+const serialSettingsFile = "serial_settings.json"
+
+var (
+	serialBaudRates = []int{9600, 19200, 38400, 57600, 115200, 230400, 460800, 921600}
+	serialParities  = []string{"None", "Odd", "Even", "Mark", "Space"}
+	serialStopBits  = []string{"1", "1.5", "2"}
+)
+
+// SerialConfig holds the line settings used to open a serial port
+type SerialConfig struct {
+	Baud     int             `json:"baud"`
+	Parity   serial.Parity   `json:"parity"`
+	StopBits serial.StopBits `json:"stop_bits"`
+	DTR      bool            `json:"dtr"`
+	RTS      bool            `json:"rts"`
+}
+
+func DefaultSerialConfig() SerialConfig {
+	return SerialConfig{
+		Baud:     115200,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+		DTR:      true,
+		RTS:      true,
+	}
+}
+
+func (sc SerialConfig) mode() *serial.Mode {
+	return &serial.Mode{
+		BaudRate: sc.Baud,
+		Parity:   sc.Parity,
+		StopBits: sc.StopBits,
+		InitialStatusBits: &serial.ModemOutputBits{
+			DTR: sc.DTR,
+			RTS: sc.RTS,
+		},
+	}
+}
+
+// validated replaces out of range settings, e.g. from a hand edited
+// settings file, with the defaults
+func (sc SerialConfig) validated() SerialConfig {
+	def := DefaultSerialConfig()
+	if sc.Baud <= 0 {
+		sc.Baud = def.Baud
+	}
+	if sc.Parity < 0 || int(sc.Parity) >= len(serialParities) {
+		sc.Parity = def.Parity
+	}
+	if sc.StopBits < 0 || int(sc.StopBits) >= len(serialStopBits) {
+		sc.StopBits = def.StopBits
+	}
+	return sc
+}
+
+func (sc SerialConfig) String() string {
+	return fmt.Sprintf("%d %s/%s", sc.Baud, serialParities[sc.Parity], serialStopBits[sc.StopBits])
+}
+
+// PortInfo describes a discovered serial port
+type PortInfo struct {
+	Name         string
+	IsUSB        bool
+	VID          string
+	PID          string
+	SerialNumber string
+	Product      string
+}
+
+// Key identifies the physical device, so settings follow it across port names
+func (p PortInfo) Key() string {
+	if p.IsUSB {
+		return p.VID + ":" + p.PID + ":" + p.SerialNumber
+	}
+	return p.Name
+}
+
+// Label is the text shown in the port selector
+func (p PortInfo) Label() string {
+	if !p.IsUSB {
+		return p.Name
+	}
+	label := fmt.Sprintf("%s [%s:%s]", p.Name, p.VID, p.PID)
+	if p.Product != "" {
+		label += " " + p.Product
+	}
+	if p.SerialNumber != "" {
+		label += " SN " + p.SerialNumber
+	}
+	return label
+}
+
+func portInfoFromDetails(d *enumerator.PortDetails) PortInfo {
+	return PortInfo{
+		Name:         d.Name,
+		IsUSB:        d.IsUSB,
+		VID:          d.VID,
+		PID:          d.PID,
+		SerialNumber: d.SerialNumber,
+		Product:      d.Product,
+	}
+}
+
+// SerialSettings is persisted between runs
+type SerialSettings struct {
+	// Only devices matching AutoConnectID ("VID:PID") are connected automatically
+	AutoConnect   bool   `json:"auto_connect"`
+	AutoConnectID string `json:"auto_connect_id"`
+
+	// Last used line settings, keyed by PortInfo.Key
+	Devices map[string]SerialConfig `json:"devices"`
+}
+
+// Matches reports whether port is the configured auto-connect device
+func (ss *SerialSettings) Matches(port PortInfo) bool {
+	return ss.AutoConnect && port.IsUSB && strings.EqualFold(port.VID+":"+port.PID, ss.AutoConnectID)
+}
+
+func loadSerialSettings() *SerialSettings {
+	settings := &SerialSettings{Devices: make(map[string]SerialConfig)}
+	data, err := os.ReadFile(serialSettingsFile)
+	if err != nil {
+		return settings
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		fmt.Println("Error parsing serial settings:", err)
+	}
+	if settings.Devices == nil {
+		settings.Devices = make(map[string]SerialConfig)
+	}
+	for key, config := range settings.Devices {
+		if valid := config.validated(); valid != config {
+			fmt.Printf("Invalid serial settings for %s, using defaults for the bad fields\n", key)
+			settings.Devices[key] = valid
+		}
+	}
+	return settings
+}
+
+func (ss *SerialSettings) save() {
+	data, err := json.MarshalIndent(ss, "", "  ")
+	if err != nil {
+		fmt.Println("Error encoding serial settings:", err)
+		return
+	}
+	if err := os.WriteFile(serialSettingsFile, data, 0644); err != nil {
+		fmt.Println("Error saving serial settings:", err)
+	}
+}
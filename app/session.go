@@ -0,0 +1,299 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Every recording goes into its own directory under logRoot, listed in
+// the session index
+const (
+	logRoot          = "log"
+	sessionIndexFile = "sessions.json"
+	sessionLogFile   = "log.csv"
+	sessionDirFormat = "2006-01-02_150405"
+)
+
+// RetentionPolicy limits the sessions kept on disk, zero disables a limit.
+// The oldest sessions are deleted first, never the one being recorded.
+type RetentionPolicy struct {
+	MaxSessions int   `json:"max_sessions"`
+	MaxBytes    int64 `json:"max_bytes"`
+}
+
+var defaultRetention = RetentionPolicy{MaxSessions: 50, MaxBytes: 2 << 30}
+
+// SessionInfo describes one recording
+type SessionInfo struct {
+	Dir      string    `json:"dir"` // under logRoot
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"` // zero while recording, or if the app did not close it
+	Device   string    `json:"device"`
+	Messages int       `json:"messages"`
+	Events   int       `json:"events"`
+	Dropped  int       `json:"dropped"` // rows lost to a full log queue
+	Frames   int       `json:"frames"`  // in the raw capture
+	Bytes    int64     `json:"bytes"`
+}
+
+// Open reports whether the session was never closed
+func (s *SessionInfo) Open() bool {
+	return s.End.IsZero()
+}
+
+// SessionIndex is persisted in logRoot/sessionIndexFile
+type SessionIndex struct {
+	Retention RetentionPolicy `json:"retention"`
+	Sessions  []SessionInfo   `json:"sessions"` // oldest first
+}
+
+func loadSessionIndex() *SessionIndex {
+	index := &SessionIndex{Retention: defaultRetention}
+	data, err := os.ReadFile(filepath.Join(logRoot, sessionIndexFile))
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		fmt.Println("Error parsing session index:", err)
+	}
+	return index
+}
+
+func (idx *SessionIndex) save() {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		fmt.Println("Error encoding session index:", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(logRoot, sessionIndexFile), data, 0644); err != nil {
+		fmt.Println("Error saving session index:", err)
+	}
+}
+
+// find returns the session recorded in dir, or nil
+func (idx *SessionIndex) find(dir string) *SessionInfo {
+	for i := range idx.Sessions {
+		if idx.Sessions[i].Dir == dir {
+			return &idx.Sessions[i]
+		}
+	}
+	return nil
+}
+
+// enforce deletes the oldest sessions until the retention policy holds,
+// keeping current
+func (idx *SessionIndex) enforce(current string) {
+	var total int64
+	for i := range idx.Sessions {
+		s := &idx.Sessions[i]
+		// Sessions that were never closed, e.g. after a crash, have no size yet
+		if s.Bytes == 0 || s.Open() {
+			s.Bytes = dirSize(filepath.Join(logRoot, s.Dir))
+		}
+		total += s.Bytes
+	}
+	r := idx.Retention
+	kept := idx.Sessions[:0]
+	count := len(idx.Sessions)
+	for _, s := range idx.Sessions {
+		over := (r.MaxSessions > 0 && count > r.MaxSessions) || (r.MaxBytes > 0 && total > r.MaxBytes)
+		if !over || s.Dir == current {
+			kept = append(kept, s)
+			continue
+		}
+		if err := removeSession(s.Dir); err != nil {
+			fmt.Println("Error removing session:", err)
+			kept = append(kept, s)
+			continue
+		}
+		fmt.Println("Removed log session " + s.Dir)
+		count--
+		total -= s.Bytes
+	}
+	idx.Sessions = kept
+}
+
+// removeSession deletes a session directory, refusing anything that is
+// not a plain directory name under logRoot
+func removeSession(dir string) error {
+	if dir == "" || dir == "." || dir == ".." || filepath.Base(dir) != dir {
+		return fmt.Errorf("invalid session directory %q", dir)
+	}
+	return os.RemoveAll(filepath.Join(logRoot, dir))
+}
+
+// newSessionDir creates a directory named after t, suffixed when a session
+// was already started within the same second
+func newSessionDir(t time.Time) (string, error) {
+	if err := os.MkdirAll(logRoot, os.ModePerm); err != nil {
+		return "", err
+	}
+	name := t.Format(sessionDirFormat)
+	for i := 2; ; i++ {
+		err := os.Mkdir(filepath.Join(logRoot, name), os.ModePerm)
+		if err == nil {
+			return name, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		name = fmt.Sprintf("%s_%d", t.Format(sessionDirFormat), i)
+	}
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// StartNewLog closes the current session and starts recording a new one.
+// Older sessions are kept, subject to the retention policy. Only swapping
+// the files in and out happens under logMu, so ingest keeps running while
+// they are flushed and old sessions are pruned.
+func (c *Connector) StartNewLog() {
+	c.sessMu.Lock()
+	defer c.sessMu.Unlock()
+
+	c.closeLog()
+
+	t := time.Now()
+	dir, err := newSessionDir(t)
+	if err != nil {
+		fmt.Println("Error creating log session:", err)
+		return
+	}
+	logFileName := filepath.Join(logRoot, dir, sessionLogFile)
+	fmt.Println("Log file: " + logFileName)
+	logFile, err := os.Create(logFileName)
+	if err != nil {
+		fmt.Println("Error opening file: " + logFileName + " with error: " + err.Error())
+		return
+	}
+	logger := newCSVLogger(logFile)
+	capture := openCapture(dir)
+	session := &SessionInfo{Dir: dir, Start: t, Device: c.deviceName()}
+
+	index := loadSessionIndex()
+	index.Sessions = append(index.Sessions, *session)
+	index.enforce(dir)
+	index.save()
+
+	c.logMu.Lock()
+	c.logger, c.capture, c.session = logger, capture, session
+	// write header
+	c.WriteHeader()
+	c.logMu.Unlock()
+}
+
+// CloseLog finishes the current session, if any
+func (c *Connector) CloseLog() {
+	c.sessMu.Lock()
+	defer c.sessMu.Unlock()
+	c.closeLog()
+}
+
+// closeLog expects the caller to hold sessMu. The queues are swapped out
+// and ended under logMu, so no write can reach a file being closed.
+func (c *Connector) closeLog() {
+	c.logMu.Lock()
+	logger, capture, session := c.logger, c.capture, c.session
+	c.logger, c.capture, c.session = nil, nil, nil
+	if logger != nil {
+		logger.stop()
+	}
+	if capture != nil {
+		capture.stop()
+	}
+	c.logMu.Unlock()
+
+	// Waits for the queued rows to be written and the files closed
+	var dropped int
+	if logger != nil {
+		logger.wait()
+		dropped = logger.Dropped()
+	}
+	if capture != nil {
+		capture.wait()
+	}
+	if session == nil {
+		return
+	}
+	session.Dropped = dropped
+
+	session.End = time.Now()
+	session.Bytes = dirSize(filepath.Join(logRoot, session.Dir))
+	index := loadSessionIndex()
+	if s := index.find(session.Dir); s != nil {
+		*s = *session
+	} else {
+		index.Sessions = append(index.Sessions, *session)
+	}
+	index.save()
+}
+
+// deviceName describes the active source for the session index
+func (c *Connector) deviceName() string {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	if c.active == nil {
+		return "none"
+	}
+	return c.active.Describe()
+}
+
+// Sessions returns the session index, with the live counts of the session
+// being recorded
+func (c *Connector) Sessions() *SessionIndex {
+	c.sessMu.Lock()
+	defer c.sessMu.Unlock()
+	index := loadSessionIndex()
+
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+	if c.session != nil {
+		if s := index.find(c.session.Dir); s != nil {
+			*s = *c.session
+			if c.logger != nil {
+				s.Dropped = c.logger.Dropped()
+			}
+		}
+	}
+	return index
+}
+
+// CurrentSession returns the directory of the session being recorded, or
+// "" when not recording
+func (c *Connector) CurrentSession() string {
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+	if c.session == nil {
+		return ""
+	}
+	return c.session.Dir
+}
+
+// SetRetention stores the retention policy and applies it right away
+func (c *Connector) SetRetention(r RetentionPolicy) {
+	c.sessMu.Lock()
+	defer c.sessMu.Unlock()
+	if err := os.MkdirAll(logRoot, os.ModePerm); err != nil {
+		fmt.Println("Error creating log folder:", err)
+		return
+	}
+	index := loadSessionIndex()
+	index.Retention = r
+	index.enforce(c.CurrentSession())
+	index.save()
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnforceCountsUnclosedSessions(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// Neither session was closed, so neither has Bytes set
+	index := &SessionIndex{Retention: RetentionPolicy{MaxBytes: 1500}}
+	for _, dir := range []string{"old", "new"} {
+		if err := os.MkdirAll(filepath.Join(logRoot, dir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(logRoot, dir, sessionLogFile), make([]byte, 1000), 0644); err != nil {
+			t.Fatal(err)
+		}
+		index.Sessions = append(index.Sessions, SessionInfo{Dir: dir})
+	}
+
+	index.enforce("new")
+	if len(index.Sessions) != 1 || index.Sessions[0].Dir != "new" || index.Sessions[0].Bytes != 1000 {
+		t.Errorf("kept %+v", index.Sessions)
+	}
+	if _, err := os.Stat(filepath.Join(logRoot, "old")); !os.IsNotExist(err) {
+		t.Error("oldest session not removed")
+	}
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/g3n/engine/gui"
+	"github.com/g3n/engine/math32"
+)
+
+// Retention choices in the sessions panel, zero is unlimited
+var (
+	sessionKeepCounts = []int{10, 20, 50, 100, 0}
+	sessionKeepSizes  = []int64{500 << 20, 1 << 30, 2 << 30, 5 << 30, 10 << 30, 0}
+)
+
+// buildSessions adds the list of recorded log sessions to the Kalman tree
+func (a *App) buildSessions() {
+	a.sess_n = a.kalman_p_t1.AddNode("Log Sessions")
+	sess_p := gui.NewPanel(a.kalman_p_t1.ContentWidth(), 0)
+	sess_vb := gui.NewVBoxLayout()
+	sess_vb.SetSpacing(2)
+	sess_vb.SetAutoHeight(true)
+	sess_p.SetLayout(sess_vb)
+
+	index := loadSessionIndex()
+
+	// Retention policy
+	ret_hb := gui.NewHBoxLayout()
+	ret_hb.SetAlignH(gui.AlignLeft)
+	ret_hb.SetAutoWidth(false)
+	ret_hb.SetSpacing(5)
+	ret_p := gui.NewPanel(sess_p.Width(), 18)
+	ret_p.SetLayout(ret_hb)
+	sess_p.Add(ret_p)
+	ret_p.Add(gui.NewLabel("Keep: "))
+	keep_dd := gui.NewDropDown(90, gui.NewImageLabel(""))
+	for i, n := range sessionKeepCounts {
+		text := "All"
+		if n > 0 {
+			text = fmt.Sprintf("%d sessions", n)
+		}
+		keep_dd.Add(gui.NewImageLabel(text))
+		if n == index.Retention.MaxSessions {
+			keep_dd.SelectPos(i)
+		}
+	}
+	ret_p.Add(keep_dd)
+	ret_p.Add(gui.NewLabel("Up to: "))
+	size_dd := gui.NewDropDown(80, gui.NewImageLabel(""))
+	for i, n := range sessionKeepSizes {
+		text := "Any size"
+		if n > 0 {
+			text = formatBytes(n)
+		}
+		size_dd.Add(gui.NewImageLabel(text))
+		if n == index.Retention.MaxBytes {
+			size_dd.SelectPos(i)
+		}
+	}
+	ret_p.Add(size_dd)
+	onRetention := func(evname string, ev interface{}) {
+		r := loadSessionIndex().Retention
+		if pos := keep_dd.SelectedPos(); pos >= 0 {
+			r.MaxSessions = sessionKeepCounts[pos]
+		}
+		if pos := size_dd.SelectedPos(); pos >= 0 {
+			r.MaxBytes = sessionKeepSizes[pos]
+		}
+		a.con.SetRetention(r)
+		a.refreshSessions()
+	}
+	keep_dd.Subscribe(gui.OnChange, onRetention)
+	size_dd.Subscribe(gui.OnChange, onRetention)
+	refresh_btn := gui.NewButton("Refresh")
+	refresh_btn.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		a.refreshSessions()
+	})
+	ret_p.Add(refresh_btn)
+	ret_p.SetHeight(refresh_btn.Height())
+
+	a.sess_list = gui.NewVList(sess_p.Width(), 120)
+	// Selecting a session sets it up for replay
+	a.sess_list.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		if sel := a.sess_list.Selected(); len(sel) == 1 {
+			if pos := a.sess_list.ItemPosition(sel[0]); pos >= 0 && pos < len(a.sess_dirs) {
+				a.replay_ed.SetText(a.sess_dirs[pos])
+			}
+		}
+	})
+	sess_p.Add(a.sess_list)
+
+	a.sess_n.Add(sess_p)
+	a.sess_n.SetExpanded(false)
+	a.refreshSessions()
+}
+
+// refreshSessions lists the recorded sessions, newest first
+func (a *App) refreshSessions() {
+	a.sess_list.Clear()
+	a.sess_dirs = a.sess_dirs[:0]
+	index := a.con.Sessions()
+	current := a.con.CurrentSession()
+	for i := len(index.Sessions) - 1; i >= 0; i-- {
+		s := index.Sessions[i]
+		length := "open"
+		if s.Dir == current {
+			length = "recording"
+		} else if !s.Open() {
+			length = s.End.Sub(s.Start).Round(time.Second).String()
+		}
+		label := gui.NewLabel(fmt.Sprintf("%s  %s  %s  %d msgs  %s",
+			s.Start.Format("2006-01-02 15:04:05"), length, s.Device, s.Messages, formatBytes(s.Bytes)))
+		if s.Dir == current {
+			label.SetColor(&math32.Color{R: 0.5, G: 1, B: 0.5})
+		}
+		a.sess_list.Add(label)
+		a.sess_dirs = append(a.sess_dirs, s.Dir)
+	}
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f kB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,284 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+// Source is a transport that delivers LocationCore frames to the Connector
+type Source interface {
+	// Open establishes the underlying connection
+	Open() error
+	// ReadFrame blocks until a complete frame is received, io.EOF ends the stream
+	ReadFrame() ([]byte, error)
+	// Close releases the underlying connection
+	Close() error
+	// Describe returns a human readable name for the GUI and console
+	Describe() string
+	// Format is the wire format used to decode the frames
+	Format() WireFormat
+}
+
+// Interval between port list scans while waiting for an unplugged device
+const serialRescanInterval = 500 * time.Millisecond
+
+// Longest a command write may take, the port has no write timeout of its own
+const serialWriteTimeout = 2 * time.Second
+
+var (
+	errWriteTimeout = errors.New("write timed out")
+	errWriteBusy    = errors.New("previous write still pending")
+)
+
+// SerialSource reads JSON line or COBS frames from a local serial port
+type SerialSource struct {
+	config SerialConfig
+	format WireFormat
+
+	mu       sync.Mutex
+	portname string    // changes when the device comes back elsewhere
+	usb      *PortInfo // USB identity, used to find the device after a replug
+	port     serial.Port
+	frames   *frameReader
+	closed   bool
+	writing  bool // a write is blocked in the driver
+}
+
+func NewSerialSource(portname string, config SerialConfig, format WireFormat) *SerialSource {
+	return &SerialSource{portname: portname, config: config, format: format}
+}
+
+func (s *SerialSource) Open() error {
+	s.mu.Lock()
+	portname := s.portname
+	s.mu.Unlock()
+	if err := s.open(portname); err != nil {
+		return err
+	}
+	usb := findPortDetails(portname)
+
+	s.mu.Lock()
+	s.usb = usb
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *SerialSource) open(portname string) error {
+	port, err := serial.Open(portname, s.config.mode())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		port.Close()
+		return errSourceClosed
+	}
+	s.portname = portname
+	s.port = port
+	s.frames = s.format.frameReader(port)
+	return nil
+}
+
+func (s *SerialSource) ReadFrame() ([]byte, error) {
+	return s.frames.ReadFrame()
+}
+
+// Framing is the configured framing until auto-detection locks in
+func (s *SerialSource) Framing() Framing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frames == nil {
+		return s.format.framing()
+	}
+	return s.frames.Framing()
+}
+
+// WriteFrame writes outside the lock and gives up after serialWriteTimeout,
+// so a port that stopped draining holds up neither the GUI nor Close. The
+// write itself carries on until the port is closed.
+func (s *SerialSource) WriteFrame(frame []byte, framing Framing) error {
+	s.mu.Lock()
+	port := s.port
+	if port == nil {
+		s.mu.Unlock()
+		return errNotConnected
+	}
+	if s.writing {
+		s.mu.Unlock()
+		return errWriteBusy
+	}
+	s.writing = true
+	s.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := port.Write(delimit(frame, framing))
+		s.mu.Lock()
+		s.writing = false
+		s.mu.Unlock()
+		done <- err
+	}()
+	timer := time.NewTimer(serialWriteTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errWriteTimeout
+	}
+}
+
+// Reconnect waits for the same USB device to reappear, it may come back
+// under a different port name
+func (s *SerialSource) Reconnect() error {
+	s.mu.Lock()
+	if s.port != nil {
+		s.port.Close()
+		s.port = nil
+	}
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return errSourceClosed
+		}
+
+		if portname, ok := s.locate(); ok {
+			err := s.open(portname)
+			if err == nil || err == errSourceClosed {
+				return err
+			}
+			fmt.Printf("Reopening %s failed: %v\n", portname, err)
+		}
+		time.Sleep(serialRescanInterval)
+	}
+}
+
+// locate finds the current port name of the device, matching on USB
+// VID/PID/serial number when known and on the port name otherwise
+func (s *SerialSource) locate() (string, bool) {
+	s.mu.Lock()
+	usb, portname := s.usb, s.portname
+	s.mu.Unlock()
+
+	if usb != nil {
+		details, err := enumerator.GetDetailedPortsList()
+		if err == nil {
+			for _, d := range details {
+				if d.IsUSB && d.VID == usb.VID && d.PID == usb.PID && d.SerialNumber == usb.SerialNumber {
+					return d.Name, true
+				}
+			}
+			return "", false
+		}
+	}
+
+	ports, err := serial.GetPortsList()
+	if err != nil {
+		return "", false
+	}
+	for _, p := range ports {
+		if p == portname {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func (s *SerialSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.port == nil {
+		return nil
+	}
+	err := s.port.Close()
+	s.port = nil
+	return err
+}
+
+func (s *SerialSource) Describe() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.usb != nil {
+		return fmt.Sprintf("serial %s [%s:%s] @ %s", s.portname, s.usb.VID, s.usb.PID, s.config)
+	}
+	return fmt.Sprintf("serial %s @ %s", s.portname, s.config)
+}
+
+func (s *SerialSource) Format() WireFormat {
+	return s.format
+}
+
+// findPortDetails returns the USB details of a port, or nil if unavailable
+func findPortDetails(portname string) *PortInfo {
+	details, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil
+	}
+	for _, d := range details {
+		if d.Name == portname && d.IsUSB {
+			info := portInfoFromDetails(d)
+			return &info
+		}
+	}
+	return nil
+}
+
+// MemorySource delivers frames pushed from Go code, used to drive the
+// pipeline without hardware
+type MemorySource struct {
+	name   string
+	format WireFormat
+	frames chan []byte
+	once   sync.Once
+}
+
+func NewMemorySource(name string, format WireFormat, buffer int) *MemorySource {
+	return &MemorySource{name: name, format: format, frames: make(chan []byte, buffer)}
+}
+
+// Push queues a frame, blocking while the buffer is full
+func (m *MemorySource) Push(frame []byte) {
+	m.frames <- frame
+}
+
+// End signals that no more frames will be pushed
+func (m *MemorySource) End() {
+	m.once.Do(func() { close(m.frames) })
+}
+
+func (m *MemorySource) Open() error {
+	return nil
+}
+
+func (m *MemorySource) ReadFrame() ([]byte, error) {
+	frame, ok := <-m.frames
+	if !ok {
+		return nil, io.EOF
+	}
+	return frame, nil
+}
+
+func (m *MemorySource) Close() error {
+	return nil
+}
+
+func (m *MemorySource) Describe() string {
+	return "memory " + m.name
+}
+
+func (m *MemorySource) Format() WireFormat {
+	return m.format
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const tcpRetryInterval = 1 * time.Second
+
+// Longest a command write may take before the peer is considered stalled
+const tcpWriteTimeout = 2 * time.Second
+
+var errSourceClosed = errors.New("source closed")
+
+// ReconnectingSource is a Source that can recover from a read error by
+// re-establishing its connection instead of ending the stream
+type ReconnectingSource interface {
+	Source
+	// Reconnect blocks until the connection is back, or fails once the source is closed
+	Reconnect() error
+}
+
+// TCPSource reads JSON line or COBS frames over TCP, either by dialing a
+// serial-to-WiFi bridge or by listening for a single device to connect
+type TCPSource struct {
+	addr   string
+	listen bool
+	format WireFormat
+
+	mu       sync.Mutex
+	listener net.Listener
+	conn     net.Conn
+	frames   *frameReader
+	closed   bool
+}
+
+func NewTCPClientSource(addr string, format WireFormat) *TCPSource {
+	return &TCPSource{addr: addr, format: format}
+}
+
+func NewTCPServerSource(addr string, format WireFormat) *TCPSource {
+	return &TCPSource{addr: addr, listen: true, format: format}
+}
+
+func (t *TCPSource) Open() error {
+	if t.listen {
+		listener, err := net.Listen("tcp", t.addr)
+		if err != nil {
+			return err
+		}
+		t.mu.Lock()
+		t.listener = listener
+		t.mu.Unlock()
+		return t.establish()
+	}
+	// The bridge may not be up yet, keep dialing like after a drop
+	return t.retry("Connecting to")
+}
+
+// establish dials the remote or accepts the next device on the listener
+func (t *TCPSource) establish() error {
+	var conn net.Conn
+	var err error
+	if t.listen {
+		t.mu.Lock()
+		listener := t.listener
+		t.mu.Unlock()
+		if listener == nil {
+			return errSourceClosed
+		}
+		conn, err = listener.Accept()
+	} else {
+		conn, err = net.DialTimeout("tcp", t.addr, 5*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		conn.Close()
+		return errSourceClosed
+	}
+	t.conn = conn
+	t.frames = t.format.frameReader(conn)
+	return nil
+}
+
+func (t *TCPSource) ReadFrame() ([]byte, error) {
+	return t.frames.ReadFrame()
+}
+
+// Framing is the configured framing until auto-detection locks in
+func (t *TCPSource) Framing() Framing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.frames == nil {
+		return t.format.framing()
+	}
+	return t.frames.Framing()
+}
+
+// WriteFrame writes outside the lock with a deadline, so a stalled peer
+// holds up neither the caller for long nor Close
+func (t *TCPSource) WriteFrame(frame []byte, framing Framing) error {
+	t.mu.Lock()
+	conn := t.conn
+	t.mu.Unlock()
+	if conn == nil {
+		return errNotConnected
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout)); err != nil {
+		return err
+	}
+	_, err := conn.Write(delimit(frame, framing))
+	return err
+}
+
+func (t *TCPSource) Reconnect() error {
+	t.mu.Lock()
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	t.mu.Unlock()
+
+	return t.retry("Reconnect to")
+}
+
+// retry establishes the connection every tcpRetryInterval until it
+// succeeds or the source is closed
+func (t *TCPSource) retry(what string) error {
+	for {
+		t.mu.Lock()
+		closed := t.closed
+		t.mu.Unlock()
+		if closed {
+			return errSourceClosed
+		}
+
+		err := t.establish()
+		if err == nil || err == errSourceClosed {
+			return err
+		}
+		fmt.Printf("%s %s failed: %v\n", what, t.Describe(), err)
+		time.Sleep(tcpRetryInterval)
+	}
+}
+
+func (t *TCPSource) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.listener != nil {
+		t.listener.Close()
+		t.listener = nil
+	}
+	if t.conn != nil {
+		err := t.conn.Close()
+		t.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (t *TCPSource) Describe() string {
+	if t.listen {
+		return "tcp server " + t.addr
+	}
+	return "tcp " + t.addr
+}
+
+func (t *TCPSource) Format() WireFormat {
+	return t.format
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// Largest datagram we expect, a full message with P, K and f fits easily
+const udpMaxDatagram = 64 * 1024
+
+// UDPSource listens for datagrams that each carry one complete message,
+// so the framing part of the wire format is ignored. Commands are sent
+// back to whoever sent the last datagram.
+type UDPSource struct {
+	addr   string
+	format WireFormat
+
+	buf []byte
+
+	mu     sync.Mutex
+	conn   *net.UDPConn
+	peer   *net.UDPAddr
+	closed bool
+}
+
+func NewUDPSource(addr string, format WireFormat) *UDPSource {
+	return &UDPSource{addr: addr, format: format}
+}
+
+func (u *UDPSource) Open() error {
+	laddr, err := net.ResolveUDPAddr("udp", u.addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return err
+	}
+	u.buf = make([]byte, udpMaxDatagram)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		conn.Close()
+		return errSourceClosed
+	}
+	u.conn = conn
+	return nil
+}
+
+func (u *UDPSource) ReadFrame() ([]byte, error) {
+	u.mu.Lock()
+	conn := u.conn
+	u.mu.Unlock()
+
+	n, peer, err := conn.ReadFromUDP(u.buf)
+	if errors.Is(err, net.ErrClosed) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	u.peer = peer
+	u.mu.Unlock()
+
+	frame := make([]byte, n)
+	copy(frame, u.buf[:n])
+	return frame, nil
+}
+
+// Framing follows the format, datagrams are never auto-detected
+func (u *UDPSource) Framing() Framing {
+	return u.format.framing()
+}
+
+// WriteFrame sends one datagram to the device, datagrams need no delimiter
+func (u *UDPSource) WriteFrame(frame []byte, framing Framing) error {
+	u.mu.Lock()
+	conn, peer := u.conn, u.peer
+	u.mu.Unlock()
+	if peer == nil {
+		return errNotConnected
+	}
+	_, err := conn.WriteToUDP(frame, peer)
+	return err
+}
+
+func (u *UDPSource) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closed = true
+	if u.conn == nil {
+		return nil
+	}
+	return u.conn.Close()
+}
+
+func (u *UDPSource) Describe() string {
+	return "udp " + u.addr
+}
+
+func (u *UDPSource) Format() WireFormat {
+	return u.format
+}
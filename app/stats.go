@@ -0,0 +1,137 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Default message period of the firmware, driven by the 50 Hz predict
+// step, used until the rate is reported or enough gaps were seen
+const nominalPeriodMicros = 1e6 / 50
+
+// Recent gaps between messages the period is estimated from
+const periodSamples = 32
+
+// LinkStats counts sequencing problems detected from the firmware micros field
+type LinkStats struct {
+	Received  int
+	Lost      int
+	Reordered int
+
+	// Frames rejected by the decoder, corrupt ones failed COBS or CRC checks
+	Invalid   int
+	Corrupt   int
+	LastError string
+}
+
+func (s LinkStats) String() string {
+	return fmt.Sprintf("received %d, lost %d, out-of-order %d, invalid %d, corrupt %d", s.Received, s.Lost, s.Reordered, s.Invalid, s.Corrupt)
+}
+
+// linkTracker accumulates LinkStats for the active connection
+type linkTracker struct {
+	mu         sync.Mutex
+	stats      LinkStats
+	lastMicros float64
+	seen       bool
+
+	ratePeriod float64   // from the predict rate the device reported, 0 if unknown
+	gaps       []float64 // recent gaps, ring of periodSamples
+	nextGap    int
+}
+
+func (l *linkTracker) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats = LinkStats{}
+	l.seen = false
+	l.ratePeriod = 0
+	l.gaps = l.gaps[:0]
+	l.nextGap = 0
+}
+
+// setRate takes the message period from the device's predict rate
+func (l *linkTracker) setRate(predictHz float32) {
+	if predictHz <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ratePeriod = 1e6 / float64(predictHz)
+}
+
+// period is the expected gap between messages, the reported rate or else
+// the median recent gap. The caller holds mu.
+func (l *linkTracker) period() float64 {
+	if l.ratePeriod > 0 {
+		return l.ratePeriod
+	}
+	if len(l.gaps) < periodSamples/2 {
+		return nominalPeriodMicros
+	}
+	sorted := append([]float64(nil), l.gaps...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// track records a message timestamp and reports whether it arrived in order.
+// Gaps longer than the message period are counted as lost messages.
+func (l *linkTracker) track(micros float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.Received++
+	if !l.seen {
+		l.seen = true
+		l.lastMicros = micros
+		return true
+	}
+
+	delta := micros - l.lastMicros
+	if delta < 0 {
+		l.stats.Reordered++
+		return false
+	}
+	if period := l.period(); delta > 1.5*period {
+		l.stats.Lost += int(math.Round(delta/period)) - 1
+	}
+	// Messages of one step can share a timestamp, those do not set the period
+	if delta > 0 {
+		if len(l.gaps) < periodSamples {
+			l.gaps = append(l.gaps, delta)
+		} else {
+			l.gaps[l.nextGap] = delta
+			l.nextGap = (l.nextGap + 1) % periodSamples
+		}
+	}
+	l.lastMicros = micros
+	return true
+}
+
+// invalid counts a frame that failed to decode
+func (l *linkTracker) invalid(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if errors.Is(err, errCorruptFrame) {
+		l.stats.Corrupt++
+	} else {
+		l.stats.Invalid++
+	}
+	l.stats.LastError = err.Error()
+}
+
+// last returns the most recent in-order timestamp
+func (l *linkTracker) last() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastMicros
+}
+
+func (l *linkTracker) snapshot() LinkStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
@@ -0,0 +1,29 @@
+package app
+
+import "testing"
+
+func TestLinkLossAtOtherRates(t *testing.T) {
+	// 200 Hz, with five messages missing after the first second
+	var l linkTracker
+	micros := 0.0
+	for i := 0; i < 400; i++ {
+		if i == 200 {
+			micros += 5 * 5000
+		}
+		micros += 5000
+		l.track(micros)
+	}
+	if s := l.snapshot(); s.Lost != 5 {
+		t.Errorf("200 Hz: lost %d, want 5", s.Lost)
+	}
+
+	// 10 Hz as reported by the device, no gap is a loss
+	l.reset()
+	l.setRate(10)
+	for i := 0; i < 20; i++ {
+		l.track(float64(i) * 100000)
+	}
+	if s := l.snapshot(); s.Lost != 0 {
+		t.Errorf("10 Hz: lost %d, want 0", s.Lost)
+	}
+}
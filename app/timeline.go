@@ -0,0 +1,99 @@
+package app
+
+import (
+	"sort"
+
+	"github.com/g3n/engine/math32"
+)
+
+// Range of the firmware's u32 micros counter, it wraps every ~71.6 minutes
+const microsRange = 1 << 32
+
+// Backward jumps longer than this are a device restart, not reordering
+const restartMicros = 1e6
+
+// deviceClock unwraps the firmware micros into a monotonic timeline that
+// continues across counter wraparound and device restarts
+type deviceClock struct {
+	offset  float64
+	lastRaw float64
+	last    float64 // unwrapped
+	seen    bool
+}
+
+func (d *deviceClock) unwrap(raw float64) float64 {
+	back := d.lastRaw - raw
+	switch {
+	case !d.seen:
+		d.seen = true
+	case back > microsRange/2:
+		d.offset += microsRange
+	case back < -microsRange/2:
+		// Straggler from before the last wrap
+		return raw + d.offset - microsRange
+	case back > restartMicros:
+		// Carry on from where the previous run stopped
+		d.offset = d.last - raw
+	case back > 0:
+		// Reordered, the link tracker drops it
+		return raw + d.offset
+	}
+	d.lastRaw = raw
+	d.last = raw + d.offset
+	return d.last
+}
+
+// Sample is one history entry on the unwrapped device timeline
+type Sample[T any] struct {
+	T     float64 // seconds
+	Kind  MessageKind
+	Value T
+}
+
+// searchTime returns the index of the first sample at or after t
+func searchTime[T any](h *History[Sample[T]], t float64) int {
+	return sort.Search(h.Len(), func(i int) bool {
+		return h.At(i).T >= t
+	})
+}
+
+// resampleVec returns n evenly spaced values of h over [from, to], linearly
+// interpolated and holding the end values outside the stored samples
+func resampleVec(h *History[Sample[math32.Vector3]], from, to float64, n int) []math32.Vector3 {
+	return resample(h, from, to, n,
+		func(v math32.Vector3) math32.Vector3 { return v },
+		func(a, b math32.Vector3, f float32) math32.Vector3 { return *a.Lerp(&b, f) })
+}
+
+// resample returns n evenly spaced values picked out of the samples of h
+// over [from, to], interpolated with lerp and holding the end values
+// outside the stored samples
+func resample[T, V any](h *History[Sample[T]], from, to float64, n int, value func(T) V, lerp func(a, b V, f float32) V) []V {
+	if h.Len() == 0 || n < 2 {
+		return nil
+	}
+	out := make([]V, n)
+	step := (to - from) / float64(n-1)
+	i := searchTime(h, from)
+	for k := range out {
+		t := from + float64(k)*step
+		for i < h.Len() && h.At(i).T < t {
+			i++
+		}
+		switch {
+		case i == 0:
+			out[k] = value(h.At(0).Value)
+		case i == h.Len():
+			out[k] = value(h.At(i - 1).Value)
+		default:
+			prev, next := h.At(i-1), h.At(i)
+			f := float32((t - prev.T) / (next.T - prev.T))
+			out[k] = lerp(value(prev.Value), value(next.Value), f)
+		}
+	}
+	return out
+}
+
+func lerpF32(a, b float32, f float32) float32 {
+	return a + (b-a)*f
+}
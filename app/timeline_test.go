@@ -0,0 +1,27 @@
+package app
+
+import "testing"
+
+func TestDeviceClock(t *testing.T) {
+	var d deviceClock
+	steps := []struct {
+		name string
+		raw  float64
+		want float64
+	}{
+		{"first", microsRange - 2000, microsRange - 2000},
+		{"before wrap", microsRange - 1000, microsRange - 1000},
+		{"wraparound", 1000, microsRange + 1000},
+		{"straggler", microsRange - 500, microsRange - 500},
+		{"after wrap", 3000, microsRange + 3000},
+		{"reordered", 2500, microsRange + 2500},
+		{"running", 5e6, microsRange + 5e6},
+		{"restart", 10, microsRange + 5e6},
+		{"after restart", 20010, microsRange + 5e6 + 20000},
+	}
+	for _, s := range steps {
+		if got := d.unwrap(s.raw); got != s.want {
+			t.Errorf("%s: unwrap(%.0f) = %.0f, want %.0f", s.name, s.raw, got, s.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/g3n/engine/gui"
+	"github.com/g3n/engine/math32"
+)
+
+// Trail decimation choices, a state sample is drawn when it is at least
+// this far (scene units, cm) or this long after the last drawn one
+var trailDecimations = []struct {
+	name    string
+	dist    float32
+	seconds float64
+}{
+	{"Every sample", 0, 0},
+	{"1 cm", 1, 0},
+	{"5 cm", 5, 0},
+	{"20 ms", 0, 0.02},
+	{"100 ms", 0, 0.1},
+}
+
+// Default trail look, width in scene units (cm)
+const (
+	trailWidth    = 0.2
+	trailMaxWidth = 2
+	trailOpacity  = 0.5
+)
+
+// Colour of trail points when not colour mapped
+var trailColor = math32.Color{R: 0, G: 1, B: 1}
+
+// Trail colourings, the scalar of each state sample that is mapped
+// through the colormap. Ranges follow the trail unless fixed.
+var trailColorings = []struct {
+	name   string
+	format string
+	value  func(s Sample[stateScalars]) float32
+	fixed  bool // range is [0, 1]
+}{
+	{"Solid", "", nil, false},
+	{"Speed", "%.3g m/s", func(s Sample[stateScalars]) float32 { return s.Value.Speed }, false},
+	{"Position variance (tr P)", "%.3g m^2", func(s Sample[stateScalars]) float32 { return s.Value.PTrace }, false},
+	{"Innovation |y-h|", "%.3g", func(s Sample[stateScalars]) float32 { return s.Value.Innov }, false},
+	{"Predict / update", "", func(s Sample[stateScalars]) float32 {
+		switch s.Kind {
+		case KindPredict:
+			return 0
+		case KindUpdate:
+			return 1
+		}
+		return 0.5
+	}, true},
+}
+
+// Colour stops drawn in the legend bar
+const legendSteps = 48
+
+// Headroom added when the colour range grows, so that a slowly rising
+// value does not recolour the whole trail on every frame
+const trailRangePad = 0.25
+
+// updateTrail adds the state samples received since the last frame, then
+// drops the points that aged past the trail window
+func (a *App) updateTrail(snap *filterState) {
+	h := snap.x_pos_a
+	from := h.Len() - (h.Pushed() - a.trail_seen)
+	if from < 0 {
+		from = 0
+	}
+	h.Range(from, h.Len(), func(i int, s Sample[math32.Vector3]) {
+		a.pushTrail(s, snap.x_stat_a.At(i))
+	})
+	a.trail_seen = h.Pushed()
+	if a.trail_rescale {
+		// A new value fell outside the colour range
+		a.rebuildTrail(snap)
+		return
+	}
+	a.trail.SetWindow(snap.t, a.histWindow)
+}
+
+// rebuildTrail redraws the trail from history, after the window, the
+// decimation, the colouring or the zero point changed
+func (a *App) rebuildTrail(snap *filterState) {
+	a.trail.Clear()
+	a.trail_any = false
+
+	h := snap.x_pos_a
+	from := snap.t - a.histWindow
+	if a.trail_from > from {
+		from = a.trail_from
+	}
+	first := searchTime(h, from)
+	a.trailRange(snap.x_stat_a, first)
+	h.Range(first, h.Len(), func(i int, s Sample[math32.Vector3]) {
+		a.pushTrail(s, snap.x_stat_a.At(i))
+	})
+	a.trail_seen = h.Pushed()
+	a.trail_rescale = false
+	a.trail.SetWindow(snap.t, a.histWindow)
+}
+
+// trailRange sets the colour range to the values from first on. The
+// scalars are magnitudes, so the range starts at zero.
+func (a *App) trailRange(h *History[Sample[stateScalars]], first int) {
+	coloring := trailColorings[a.trail_col]
+	a.trail_cmin, a.trail_cmax = 0, 1
+	if coloring.value != nil && !coloring.fixed {
+		a.trail_cmax = 0
+		h.Range(first, h.Len(), func(i int, s Sample[stateScalars]) {
+			if v := coloring.value(s); v > a.trail_cmax {
+				a.trail_cmax = v
+			}
+		})
+		a.trail_cmax *= 1 + trailRangePad
+		if a.trail_cmax <= 0 {
+			a.trail_cmax = 1
+		}
+	}
+	a.updateLegend()
+}
+
+// pushTrail extends the trail to s unless decimation drops it
+func (a *App) pushTrail(s Sample[math32.Vector3], stat Sample[stateScalars]) {
+	if s.T < a.trail_from {
+		return
+	}
+	if a.trail_any {
+		d := trailDecimations[a.trail_dec]
+		if d.dist > 0 && s.Value.DistanceTo(&a.trail_last.Value) < d.dist {
+			return
+		}
+		if d.seconds > 0 && s.T-a.trail_last.T < d.seconds {
+			return
+		}
+	}
+	a.trail_any = true
+	a.trail_last = s
+
+	color := trailColor
+	if value := trailColorings[a.trail_col].value; value != nil {
+		v := value(stat)
+		if v > a.trail_cmax {
+			a.trail_rescale = true
+		}
+		color = colormaps[a.trail_cmap].At((v - a.trail_cmin) / (a.trail_cmax - a.trail_cmin))
+	}
+
+	pos := s.Value
+	pos.Add(&a.pos_offset)
+	a.trail.Add(pos, s.T, color)
+}
+
+// buildLegend adds the colour scale overlay at x, y on the main panel
+func (a *App) buildLegend(x, y float32) {
+	a.legend_p = gui.NewPanel(legendSteps*4+8, 0)
+	a.legend_p.SetPaddings(2, 4, 2, 4)
+	a.legend_p.SetColor4(&math32.Color4{R: 0.1, G: 0.1, B: 0.1, A: 0.7})
+	legend_vb := gui.NewVBoxLayout()
+	legend_vb.SetAutoHeight(true)
+	legend_vb.SetSpacing(2)
+	a.legend_p.SetLayout(legend_vb)
+
+	a.legend_l = gui.NewLabel("")
+	a.legend_l.SetColor(&math32.Color{R: 1, G: 1, B: 1})
+	a.legend_p.Add(a.legend_l)
+
+	bar_hb := gui.NewHBoxLayout()
+	bar_p := gui.NewPanel(legendSteps*4, 10)
+	bar_p.SetLayout(bar_hb)
+	a.legend_p.Add(bar_p)
+	a.legend_bar = make([]*gui.Panel, legendSteps)
+	for i := range a.legend_bar {
+		a.legend_bar[i] = gui.NewPanel(4, 10)
+		bar_p.Add(a.legend_bar[i])
+	}
+
+	ends_hb := gui.NewHBoxLayout()
+	ends_hb.SetAlignH(gui.AlignWidth)
+	ends_p := gui.NewPanel(legendSteps*4, 0)
+	ends_p.SetLayout(ends_hb)
+	a.legend_p.Add(ends_p)
+	a.legend_min_l = gui.NewLabel("")
+	a.legend_min_l.SetColor(&math32.Color{R: 1, G: 1, B: 1})
+	ends_p.Add(a.legend_min_l)
+	a.legend_max_l = gui.NewLabel("")
+	a.legend_max_l.SetColor(&math32.Color{R: 1, G: 1, B: 1})
+	ends_p.Add(a.legend_max_l)
+	ends_p.SetHeight(a.legend_min_l.Height())
+
+	a.mainPanel.Add(a.legend_p)
+	a.legend_p.SetPosition(x, y)
+	a.updateLegend()
+}
+
+// updateLegend shows the current colouring, colormap and range
+func (a *App) updateLegend() {
+	if a.legend_p == nil {
+		return
+	}
+	coloring := trailColorings[a.trail_col]
+	a.legend_p.SetVisible(coloring.value != nil)
+	if coloring.value == nil {
+		return
+	}
+
+	cmap := colormaps[a.trail_cmap]
+	for i, p := range a.legend_bar {
+		c := cmap.At(float32(i) / (legendSteps - 1))
+		p.SetColor(&c)
+	}
+	a.legend_l.SetText(coloring.name)
+	if coloring.fixed {
+		a.legend_min_l.SetText("predict")
+		a.legend_max_l.SetText("update")
+	} else {
+		a.legend_min_l.SetText(fmt.Sprintf(coloring.format, a.trail_cmin))
+		a.legend_max_l.SetText(fmt.Sprintf(coloring.format, a.trail_cmax))
+	}
+}
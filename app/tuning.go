@@ -0,0 +1,140 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/g3n/engine/gui"
+	"github.com/g3n/engine/math32"
+)
+
+// Tunable parameter groups, in the order of the tuning panel rows
+var tuneGroups = []struct {
+	name string
+	hint string
+	n    int
+}{
+	{"Q", "Process noise (x y z vx vy vz)", 6},
+	{"R", "Measurement noise (of x y z)", 3},
+	{"P0", "Initial covariance (x y z vx vy vz)", 6},
+}
+
+// buildTuning adds the editable Q, R and P0 panel to the Kalman tree
+func (a *App) buildTuning() {
+	a.tune_n = a.kalman_p_t1.AddNode("Tuning (Q, R, P0)")
+	tune_p := gui.NewPanel(a.kalman_p_t1.ContentWidth(), 0)
+	tune_vb := gui.NewVBoxLayout()
+	tune_vb.SetSpacing(2)
+	tune_vb.SetAutoHeight(true)
+	tune_p.SetLayout(tune_vb)
+
+	a.tune_ed = make([][]*gui.Edit, len(tuneGroups))
+	a.tune_dev_l = make([]*gui.Label, len(tuneGroups))
+	for g, group := range tuneGroups {
+		tune_p.Add(gui.NewLabel(group.hint + ":"))
+
+		row_hb := gui.NewHBoxLayout()
+		row_hb.SetAlignH(gui.AlignLeft)
+		row_hb.SetAutoWidth(false)
+		row_hb.SetSpacing(2)
+		row_p := gui.NewPanel(tune_p.Width(), 18)
+		row_p.SetLayout(row_hb)
+		tune_p.Add(row_p)
+		row_p.Add(gui.NewLabel(fmt.Sprintf("%-3s", group.name)))
+		a.tune_ed[g] = make([]*gui.Edit, group.n)
+		for i := range a.tune_ed[g] {
+			a.tune_ed[g][i] = gui.NewEdit(56, "-")
+			row_p.Add(a.tune_ed[g][i])
+		}
+		row_p.SetHeight(a.tune_ed[g][0].Height())
+
+		a.tune_dev_l[g] = gui.NewLabel("Device: unknown")
+		a.tune_dev_l[g].SetColor(&math32.Color{R: 0.7, G: 0.7, B: 0.7})
+		tune_p.Add(a.tune_dev_l[g])
+	}
+
+	btn_hb := gui.NewHBoxLayout()
+	btn_hb.SetAlignH(gui.AlignLeft)
+	btn_hb.SetAutoWidth(false)
+	btn_hb.SetSpacing(5)
+	btn_p := gui.NewPanel(tune_p.Width(), 18)
+	btn_p.SetLayout(btn_hb)
+	tune_p.Add(btn_p)
+	apply_btn := gui.NewButton("Send to device")
+	apply_btn.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		a.applyTuning()
+	})
+	btn_p.Add(apply_btn)
+	read_btn := gui.NewButton("Read from device")
+	read_btn.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		a.tune_load = true
+		if _, err := a.con.RequestParams(); err != nil {
+			a.tune_err_l.SetText("Error: " + err.Error())
+		}
+	})
+	btn_p.Add(read_btn)
+	btn_p.SetHeight(apply_btn.Height())
+
+	a.tune_err_l = gui.NewLabel("")
+	a.tune_err_l.SetColor(&math32.Color{R: 1, G: 0.5, B: 0.5})
+	tune_p.Add(a.tune_err_l)
+
+	a.tune_n.Add(tune_p)
+	a.tune_n.SetExpanded(false)
+}
+
+// applyTuning parses the edits and sends them, then asks the device for
+// its parameters so the panel shows what was actually applied
+func (a *App) applyTuning() {
+	values := make([][]float32, len(tuneGroups))
+	for g, eds := range a.tune_ed {
+		values[g] = make([]float32, len(eds))
+		for i, ed := range eds {
+			v, err := strconv.ParseFloat(strings.TrimSpace(ed.Text()), 32)
+			if err != nil || v < 0 {
+				a.tune_err_l.SetText(fmt.Sprintf("%s[%d]: expected a non-negative number", tuneGroups[g].name, i))
+				return
+			}
+			values[g][i] = float32(v)
+		}
+	}
+	a.tune_err_l.SetText("")
+
+	if _, err := a.con.SetNoise(values[0], values[1]); err != nil {
+		a.tune_err_l.SetText("Error: " + err.Error())
+		return
+	}
+	if _, err := a.con.SetInitialCovariance(values[2]); err != nil {
+		a.tune_err_l.SetText("Error: " + err.Error())
+		return
+	}
+	if _, err := a.con.RequestParams(); err != nil {
+		a.tune_err_l.SetText("Error: " + err.Error())
+	}
+}
+
+// updateTuning shows newly acknowledged device parameters
+func (a *App) updateTuning() {
+	params := a.con.DeviceParams()
+	if params == nil || params == a.tune_params {
+		return
+	}
+	a.tune_params = params
+
+	for g, values := range [][]float32{params.Q, params.R, params.P0} {
+		text := make([]string, len(values))
+		for i, v := range values {
+			text[i] = strconv.FormatFloat(float64(v), 'g', 4, 32)
+		}
+		a.tune_dev_l[g].SetText("Device: " + strings.Join(text, "  "))
+
+		// Fill the edits on request, or when they were never set
+		for i := range values {
+			if a.tune_load || a.tune_ed[g][i].Text() == "" {
+				a.tune_ed[g][i].SetText(text[i])
+			}
+		}
+	}
+	a.tune_load = false
+}
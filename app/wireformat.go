@@ -0,0 +1,106 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WireFormat is the framing and payload encoding spoken by a device,
+// selected per connection
+type WireFormat int
+
+const (
+	FormatAuto          WireFormat = iota // JSON lines or COBS binary, detected
+	FormatJSON                            // newline-delimited JSON
+	FormatBinary                          // COBS framed binary with CRC
+	FormatCBORLines                       // newline-delimited CBOR, see frameReader
+	FormatCBORLength                      // length-prefixed CBOR
+	FormatMsgPackLines                    // newline-delimited MessagePack, see frameReader
+	FormatMsgPackLength                   // length-prefixed MessagePack
+)
+
+// Names shown in the format selector, indexed by WireFormat
+var wireFormatNames = []string{
+	"Auto",
+	"JSON lines",
+	"COBS binary",
+	"CBOR lines",
+	"CBOR length",
+	"MsgPack lines",
+	"MsgPack length",
+}
+
+func (f WireFormat) String() string {
+	if int(f) < len(wireFormatNames) {
+		return wireFormatNames[f]
+	}
+	return "Unknown"
+}
+
+// framing returns how frames of this format are delimited on a stream
+func (f WireFormat) framing() Framing {
+	switch f {
+	case FormatJSON, FormatCBORLines, FormatMsgPackLines:
+		return FramingLines
+	case FormatBinary:
+		return FramingCOBS
+	case FormatCBORLength, FormatMsgPackLength:
+		return FramingLength
+	}
+	return FramingAuto
+}
+
+// frameReader splits a stream into frames of this format. CBOR and
+// MessagePack payloads may contain 0x0A, so on lines framing a line that
+// decodes short is joined with the next one before it is passed on.
+func (f WireFormat) frameReader(r io.Reader) *frameReader {
+	fr := newFrameReader(r, f.framing())
+	switch f {
+	case FormatCBORLines:
+		fr.truncated = func(frame []byte) bool {
+			_, err := decodeCBOR(frame)
+			return errors.Is(err, errTruncated)
+		}
+	case FormatMsgPackLines:
+		fr.truncated = func(frame []byte) bool {
+			_, err := decodeMsgPack(frame)
+			return errors.Is(err, errTruncated)
+		}
+	}
+	return fr
+}
+
+// Decode parses one frame of this format into a Message
+func (f WireFormat) Decode(frame []byte) (*Message, error) {
+	switch f {
+	case FormatJSON:
+		return DecodeJSON(frame)
+	case FormatBinary:
+		return DecodeBinary(frame)
+	case FormatCBORLines, FormatCBORLength:
+		v, err := decodeCBOR(frame)
+		if err != nil {
+			return nil, err
+		}
+		return decodeGeneric(v)
+	case FormatMsgPackLines, FormatMsgPackLength:
+		v, err := decodeMsgPack(frame)
+		if err != nil {
+			return nil, err
+		}
+		return decodeGeneric(v)
+	}
+	return DecodeFrame(frame)
+}
+
+// decodeGeneric validates a decoded CBOR or MessagePack value through the
+// JSON decoder, both use the same key names as the JSON messages
+func decodeGeneric(v interface{}) (*Message, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("re-encoding payload: %w", err)
+	}
+	return DecodeJSON(raw)
+}